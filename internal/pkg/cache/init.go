@@ -0,0 +1,271 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/loui58/odin/internal/pkg/connection"
+)
+
+// notFoundMarker is stored instead of the value while ErrNotFound is cached, no codec output start with 0x00 0xff
+const notFoundMarker = "\x00\xffnotfound"
+
+// New create cache on top of rds, a RedisInstance or redistest.Fake
+func New(rds connection.RedisClient, options ...CacheFunc) (instance *CacheInstance, err error) {
+	instance = &CacheInstance{
+		redis:       rds,
+		codec:       connection.JSONCodec{},
+		keyPrefix:   "cache:",
+		ttl:         10 * time.Minute,
+		negativeTTL: 30 * time.Second,
+		jitter:      0.1,
+		loadTimeout: 10 * time.Second,
+		calls:       make(map[string]*call),
+	}
+
+	for _, option := range options {
+		if err = option(instance); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// WithTTL set how long loaded values are kept, default 10 minute
+func WithTTL(ttl time.Duration) CacheFunc {
+	return func(i *CacheInstance) error {
+		if ttl < time.Second {
+			return errors.New("[error][cache] ttl must be at least one second")
+		}
+		i.ttl = ttl
+		return nil
+	}
+}
+
+// WithNegativeTTL set how long a not found answer is kept, default 30 second. Zero disable negative caching
+func WithNegativeTTL(ttl time.Duration) CacheFunc {
+	return func(i *CacheInstance) error {
+		if ttl < 0 {
+			return errors.New("[error][cache] negative ttl must not be negative")
+		}
+		i.negativeTTL = ttl
+		return nil
+	}
+}
+
+// WithJitter extend every ttl by a random part of up to ratio of itself, so keys loaded together do not expire
+// together. Default 0.1
+func WithJitter(ratio float64) CacheFunc {
+	return func(i *CacheInstance) error {
+		if ratio < 0 || ratio > 1 {
+			return fmt.Errorf("[error][cache] jitter %v must be between 0 and 1", ratio)
+		}
+		i.jitter = ratio
+		return nil
+	}
+}
+
+// WithLoadTimeout bound how long a shared load, loader and store, may run, default 10 second. The load is not
+// canceled with the caller that started it, so it is bounded by this timeout instead
+func WithLoadTimeout(timeout time.Duration) CacheFunc {
+	return func(i *CacheInstance) error {
+		if timeout <= 0 {
+			return errors.New("[error][cache] load timeout must be positive")
+		}
+		i.loadTimeout = timeout
+		return nil
+	}
+}
+
+// WithCodec set codec of cached values, default connection.JSONCodec
+func WithCodec(codec connection.Codec) CacheFunc {
+	return func(i *CacheInstance) error {
+		if codec == nil {
+			return errors.New("[error][cache] codec must not be nil")
+		}
+		i.codec = codec
+		return nil
+	}
+}
+
+// WithMetrics report latency of every Get, tagged with result hit, negative_hit, miss or error
+func WithMetrics(metrics connection.MetricsRecorder) CacheFunc {
+	return func(i *CacheInstance) error {
+		i.metrics = metrics
+		return nil
+	}
+}
+
+// WithKeyPrefix set prefix of cache keys in redis, default "cache:"
+func WithKeyPrefix(prefix string) CacheFunc {
+	return func(i *CacheInstance) error {
+		i.keyPrefix = prefix
+		return nil
+	}
+}
+
+// Get decode cached value of key into v. On miss loader is called and its value cached, concurrent misses of
+// the same key in this process share one loader call. The shared call keep the values of the first caller ctx
+// but not its cancellation, it is bounded by the load timeout, and each caller only wait as long as its own ctx
+// allows, returning ErrCanceled or ErrDeadlineExceeded. ErrNotFound is returned, and cached for the negative
+// ttl, when loader return it. Redis errors are logged and never fail Get, the loader is then used directly.
+// A cached value that can not be decoded is deleted and loaded again
+func (i *CacheInstance) Get(ctx context.Context, key string, v interface{}, loader LoaderFunc) (err error) {
+	loggingStartTime := time.Now()
+	result := "hit"
+	defer func() {
+		if err != nil && err != ErrNotFound {
+			result = "error"
+		}
+		if i.metrics != nil {
+			i.metrics.ObserveLatency("redis", "cache", time.Since(loggingStartTime), []string{"result:" + result})
+		}
+	}()
+
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	redisKey := i.keyPrefix + key
+	cached, found, errGet := i.redis.GetBytesCtx(ctx, redisKey, nil)
+	switch {
+	case errGet != nil:
+		log.Println("[warning][cache] Get", redisKey, "failed, loading:", errGet)
+	case !found:
+	case string(cached) == notFoundMarker:
+		result = "negative_hit"
+		return ErrNotFound
+	default:
+		errDecode := i.decode(redisKey, cached, v)
+		if errDecode == nil {
+			return
+		}
+		// a value written with another shape or codec is dropped and loaded again instead of failing until
+		// it expires
+		log.Println("[warning][cache]", errDecode, "loading")
+		if errDelete := i.redis.DeleteCtx(ctx, redisKey, nil); errDelete != nil {
+			log.Println("[warning][cache] Delete", redisKey, "failed:", errDelete)
+		}
+	}
+
+	result = "miss"
+	data, err := i.load(ctx, key, redisKey, loader)
+	if err != nil {
+		return
+	}
+	return i.decode(redisKey, data, v)
+}
+
+// Set encode v and cache it for key, to refresh the cache right after a write
+func (i *CacheInstance) Set(ctx context.Context, key string, v interface{}) (err error) {
+	data, err := i.codec.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("[error][cache] Failed to encode %s %s", key, err)
+	}
+	return i.redis.SetCtx(ctx, i.keyPrefix+key, string(data), i.expireSeconds(i.ttl), nil)
+}
+
+// Delete drop cached value of key, the next Get call the loader
+func (i *CacheInstance) Delete(ctx context.Context, key string) (err error) {
+	return i.redis.DeleteCtx(ctx, i.keyPrefix+key, nil)
+}
+
+// load share one loader call between every concurrent miss of key, each caller wait for it as long as its ctx
+// allows
+func (i *CacheInstance) load(ctx context.Context, key, redisKey string, loader LoaderFunc) ([]byte, error) {
+	i.mu.Lock()
+	c, ok := i.calls[key]
+	if !ok {
+		c = &call{done: make(chan struct{})}
+		i.calls[key] = c
+		go i.fill(ctx, c, key, redisKey, loader)
+	}
+	i.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.data, c.err
+	case <-ctx.Done():
+		return nil, ctxErr(ctx)
+	}
+}
+
+// fill call loader and cache its encoded value, under a ctx detached from the caller and bounded by loadTimeout
+func (i *CacheInstance) fill(parent context.Context, c *call, key, redisKey string, loader LoaderFunc) {
+	ctx, cancel := context.WithTimeout(detached{parent}, i.loadTimeout)
+	defer cancel()
+	defer func() {
+		i.mu.Lock()
+		delete(i.calls, key)
+		i.mu.Unlock()
+		close(c.done)
+	}()
+
+	value, err := loader(ctx, key)
+	switch {
+	case err == ErrNotFound:
+		c.err = err
+		if i.negativeTTL > 0 {
+			i.store(ctx, redisKey, notFoundMarker, i.negativeTTL)
+		}
+	case err != nil:
+		c.err = err
+	default:
+		c.data, c.err = i.codec.Marshal(value)
+		if c.err != nil {
+			c.err = fmt.Errorf("[error][cache] Failed to encode %s %s", key, c.err)
+			break
+		}
+		i.store(ctx, redisKey, string(c.data), i.ttl)
+	}
+}
+
+// detached keep the values of a context but never end, so a shared load outlive the caller that started it
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (deadline time.Time, ok bool) { return }
+func (detached) Done() <-chan struct{}                   { return nil }
+func (detached) Err() error                              { return nil }
+
+// ctxErr translate context error into cache error
+func ctxErr(ctx context.Context) error {
+	switch ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return ErrDeadlineExceeded
+	default:
+		return ErrCanceled
+	}
+}
+
+// store cache data for ttl extended by jitter, failure only cost a later miss so it is logged
+func (i *CacheInstance) store(ctx context.Context, redisKey, data string, ttl time.Duration) {
+	if errSet := i.redis.SetCtx(ctx, redisKey, data, i.expireSeconds(ttl), nil); errSet != nil {
+		log.Println("[warning][cache] Set", redisKey, "failed:", errSet)
+	}
+}
+
+// expireSeconds return ttl extended by a random part of up to jitter of itself, in second for SETEX
+func (i *CacheInstance) expireSeconds(ttl time.Duration) int {
+	if i.jitter > 0 {
+		ttl += time.Duration(rand.Int63n(int64(float64(ttl)*i.jitter) + 1))
+	}
+	seconds := int(ttl / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
+
+func (i *CacheInstance) decode(redisKey string, data []byte, v interface{}) error {
+	if err := i.codec.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("[error][cache] Failed to decode %s %s", redisKey, err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/loui58/odin/internal/pkg/connection/redistest"
+)
+
+// rawCodec store strings as is, so an empty string is an empty redis value
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) { return []byte(v.(string)), nil }
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	*(v.(*string)) = string(data)
+	return nil
+}
+
+func newTestCache(t *testing.T, options ...CacheFunc) (*CacheInstance, *redistest.Fake) {
+	t.Helper()
+	fake := redistest.NewFake()
+	c, err := New(fake, append([]CacheFunc{WithJitter(0)}, options...)...)
+	if err != nil {
+		t.Fatalf("new: %s", err)
+	}
+	return c, fake
+}
+
+func TestGet(t *testing.T) {
+	errSource := errors.New("source down")
+	tests := []struct {
+		name    string
+		options []CacheFunc
+		// cached is stored under the key before the first Get when not nil
+		cached *string
+		value  interface{}
+		err    error
+		// want is the value and error of both Get, calls the loader calls
+		want    string
+		wantErr error
+		calls   int32
+	}{
+		{name: "miss then hit", value: "v", want: "v", calls: 1},
+		{name: "not found cached", err: ErrNotFound, wantErr: ErrNotFound, calls: 1},
+		{name: "not found without negative ttl", options: []CacheFunc{WithNegativeTTL(0)}, err: ErrNotFound, wantErr: ErrNotFound, calls: 2},
+		{name: "loader error not cached", err: errSource, wantErr: errSource, calls: 2},
+		{name: "empty value is a hit", options: []CacheFunc{WithCodec(rawCodec{})}, value: "", want: "", calls: 1},
+		{name: "undecodable value loaded again", cached: strPtr("not json"), value: "v", want: "v", calls: 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c, fake := newTestCache(t, tc.options...)
+			if tc.cached != nil {
+				if err := fake.Set("cache:k", *tc.cached, 0, nil); err != nil {
+					t.Fatalf("set: %s", err)
+				}
+			}
+			var calls int32
+			loader := func(ctx context.Context, key string) (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				return tc.value, tc.err
+			}
+			for n := 0; n < 2; n++ {
+				var got string
+				err := c.Get(context.Background(), "k", &got, loader)
+				if err != tc.wantErr {
+					t.Fatalf("get %d: err %v, want %v", n, err, tc.wantErr)
+				}
+				if err == nil && got != tc.want {
+					t.Fatalf("get %d: %q, want %q", n, got, tc.want)
+				}
+			}
+			if calls != tc.calls {
+				t.Fatalf("loader called %d times, want %d", calls, tc.calls)
+			}
+		})
+	}
+}
+
+func TestGetSingleflight(t *testing.T) {
+	c, _ := newTestCache(t)
+	var calls int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context, key string) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "v", nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for n := 0; n < 8; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var got string
+			if err := c.Get(context.Background(), "k", &got, loader); err != nil || got != "v" {
+				errs <- errors.New("get " + got)
+			}
+		}()
+	}
+	// let every caller join the load before it ends
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if calls != 1 {
+		t.Fatalf("loader called %d times, want 1", calls)
+	}
+}
+
+func TestGetWaiterCanceled(t *testing.T) {
+	c, _ := newTestCache(t)
+	release := make(chan struct{})
+	loader := func(ctx context.Context, key string) (interface{}, error) {
+		<-release
+		return "v", ctx.Err()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var got string
+	if err := c.Get(ctx, "k", &got, loader); err != ErrDeadlineExceeded {
+		t.Fatalf("get: err %v, want %v", err, ErrDeadlineExceeded)
+	}
+
+	// the load outlive the caller that started it and fill the cache
+	close(release)
+	for n := 0; n < 100; n++ {
+		c.mu.Lock()
+		inFlight := len(c.calls)
+		c.mu.Unlock()
+		if inFlight == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := c.Get(context.Background(), "k", &got, nil); err != nil || got != "v" {
+		t.Fatalf("get after load: %q %v, want cached v", got, err)
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
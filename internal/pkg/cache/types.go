@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/loui58/odin/internal/pkg/connection"
+)
+
+// ErrNotFound is returned by a LoaderFunc when the value does not exist, and by Get while that answer is cached
+var ErrNotFound = errors.New("[error][cache] not found")
+
+var (
+	// ErrCanceled is returned by Get when the caller context is canceled before the value is loaded
+	ErrCanceled = errors.New("[error][cache] get canceled")
+	// ErrDeadlineExceeded is returned by Get when the caller context deadline passes before the value is loaded
+	ErrDeadlineExceeded = errors.New("[error][cache] get deadline exceeded")
+)
+
+// LoaderFunc load value of key from the source of truth, such as cassandra, on cache miss. It return
+// ErrNotFound when key does not exist
+type LoaderFunc func(ctx context.Context, key string) (value interface{}, err error)
+
+type CacheFunc func(*CacheInstance) error
+
+type (
+	CacheInstance struct {
+		redis     connection.RedisClient
+		codec     connection.Codec
+		metrics   connection.MetricsRecorder
+		keyPrefix string
+		// ttl of loaded values and negativeTTL of not found answers, each extended by up to jitter of itself
+		ttl         time.Duration
+		negativeTTL time.Duration
+		jitter      float64
+		// loadTimeout bound a shared load, which run detached from the callers context
+		loadTimeout time.Duration
+
+		// mu guard calls, the loads in flight by key
+		mu    sync.Mutex
+		calls map[string]*call
+	}
+
+	// call is one load shared by every concurrent miss of a key
+	call struct {
+		done chan struct{}
+		data []byte
+		err  error
+	}
+)
@@ -7,7 +7,14 @@ import (
 	"github.com/gocql/gocql"
 )
 
+// NewCassandra create cassandra session without latency reporting
 func NewCassandra(cfg CassandraConfig) (sess *gocql.Session, err error) {
+	return NewCassandraWithMetrics(cfg, nil)
+}
+
+// NewCassandraWithMetrics create cassandra session reporting query latency to metrics, nil metrics disable
+// reporting. Trace context of a query is taken from the context given to Query.WithContext
+func NewCassandraWithMetrics(cfg CassandraConfig, metrics MetricsRecorder) (sess *gocql.Session, err error) {
 	cluster := gocql.NewCluster(cfg.ClusterDSN...)
 	cluster.Port = cfg.Port
 	if cfg.Port <= 0 {
@@ -17,6 +24,14 @@ func NewCassandra(cfg CassandraConfig) (sess *gocql.Session, err error) {
 		cluster.Keyspace = cfg.Keyspace
 	}
 	cluster.Consistency = gocql.One
+	if metrics != nil || cfg.Tracing {
+		observer := cassandraObserver{metrics: metrics}
+		if cfg.Tracing {
+			observer.tracer = tracer()
+		}
+		cluster.QueryObserver = observer
+		cluster.BatchObserver = observer
+	}
 
 	if cfg.Environment == "development" || cfg.Environment == "" {
 		cluster.DisableInitialHostLookup = true
@@ -1,6 +1,7 @@
 package connection
 
 import (
+	"net/http"
 	"strings"
 
 	"github.com/json-iterator/go"
@@ -8,14 +9,29 @@ import (
 	elastic "gopkg.in/olivere/elastic.v5"
 )
 
+// NewElastic create elastic client without latency reporting
 func NewElastic(cfg ElasticConfig) (client *elastic.Client, err error) {
+	return NewElasticWithMetrics(cfg, nil)
+}
+
+// NewElasticWithMetrics create elastic client reporting request latency to metrics, nil metrics disable
+// reporting
+func NewElasticWithMetrics(cfg ElasticConfig, metrics MetricsRecorder) (client *elastic.Client, err error) {
 	dsnURL := strings.Split(cfg.DSN, ",")
-	client, err = elastic.NewClient(
+	options := []elastic.ClientOptionFunc{
 		elastic.SetURL(dsnURL...),
 		elastic.SetSniff(cfg.SetSniff),
 		elastic.SetHealthcheck(cfg.SetHealthcheck),
 		elastic.SetDecoder(&JsoniterDecoder{}),
-	)
+	}
+	if metrics != nil || cfg.Tracing {
+		transport := elasticTransport{metrics: metrics, next: http.DefaultTransport}
+		if cfg.Tracing {
+			transport.tracer = tracer()
+		}
+		options = append(options, elastic.SetHttpClient(&http.Client{Transport: transport}))
+	}
+	client, err = elastic.NewClient(options...)
 	return
 }
 
@@ -0,0 +1,150 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/json-iterator/go"
+
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+type (
+	// HealthCheckFunc return nil when the dependency can serve requests
+	HealthCheckFunc func(ctx context.Context) error
+
+	// HealthChecker run named health checks together, for readiness probes. Usage:
+	//
+	//	health := connection.NewHealthChecker(2 * time.Second)
+	//	health.AddRedis("redis", rds)
+	//	health.AddCassandra("cassandra", sess)
+	//	http.Handle("/ready", health)
+	HealthChecker struct {
+		timeout time.Duration
+
+		mu     sync.RWMutex
+		checks map[string]HealthCheckFunc
+	}
+
+	// HealthReport is the result of every check, Checks hold "ok" or the error of each check by name
+	HealthReport struct {
+		Healthy bool              `json:"healthy"`
+		Checks  map[string]string `json:"checks"`
+	}
+)
+
+// NewHealthChecker create empty health checker, every check is bounded by timeout, default 2 second
+func NewHealthChecker(timeout time.Duration) *HealthChecker {
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	return &HealthChecker{
+		timeout: timeout,
+		checks:  make(map[string]HealthCheckFunc),
+	}
+}
+
+// Add register check under name, replacing any check with the same name
+func (h *HealthChecker) Add(name string, check HealthCheckFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = check
+}
+
+// AddRedis check rds with Ping
+func (h *HealthChecker) AddRedis(name string, rds *RedisInstance) {
+	h.Add(name, rds.Ping)
+}
+
+// AddCassandra check sess with PingCassandra
+func (h *HealthChecker) AddCassandra(name string, sess *gocql.Session) {
+	h.Add(name, func(ctx context.Context) error {
+		return PingCassandra(ctx, sess)
+	})
+}
+
+// AddElastic check client with PingElastic
+func (h *HealthChecker) AddElastic(name string, client *elastic.Client) {
+	h.Add(name, func(ctx context.Context) error {
+		return PingElastic(ctx, client)
+	})
+}
+
+// Check run every check concurrently, the report is healthy when all of them succeed
+func (h *HealthChecker) Check(ctx context.Context) HealthReport {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	h.mu.RLock()
+	checks := make(map[string]HealthCheckFunc, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+	h.mu.RUnlock()
+
+	report := HealthReport{Healthy: true, Checks: make(map[string]string, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check HealthCheckFunc) {
+			defer wg.Done()
+			result := "ok"
+			if err := check(ctx); err != nil {
+				result = err.Error()
+			}
+			mu.Lock()
+			report.Checks[name] = result
+			if result != "ok" {
+				report.Healthy = false
+			}
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+	return report
+}
+
+// ServeHTTP answer the health report as JSON, with status 200 when healthy and 503 otherwise
+func (h *HealthChecker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := h.Check(r.Context())
+	status := http.StatusOK
+	if !report.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+	body, _ := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(report)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// PingCassandra check sess can run a query on system.local within ctx
+func PingCassandra(ctx context.Context, sess *gocql.Session) error {
+	if sess == nil || sess.Closed() {
+		return errors.New("[error][cassandra] session is closed")
+	}
+	if err := sess.Query("SELECT release_version FROM system.local").WithContext(ctx).Exec(); err != nil {
+		return fmt.Errorf("[error][cassandra] Failed to ping %s", err)
+	}
+	return nil
+}
+
+// PingElastic check cluster health of client within ctx, a red cluster is unhealthy
+func PingElastic(ctx context.Context, client *elastic.Client) error {
+	if client == nil {
+		return errors.New("[error][elastic] client is nil")
+	}
+	health, err := client.ClusterHealth().Do(ctx)
+	if err != nil {
+		return fmt.Errorf("[error][elastic] Failed to ping %s", err)
+	}
+	if health.Status == "red" {
+		return fmt.Errorf("[error][elastic] cluster %s is red", health.ClusterName)
+	}
+	return nil
+}
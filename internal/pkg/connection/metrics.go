@@ -0,0 +1,120 @@
+package connection
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type (
+	// NoopMetrics drop every observation, it is used when no recorder is given
+	NoopMetrics struct{}
+
+	// cassandraObserver report latency and span of every query and batch of a gocql session.
+	// metrics and tracer are each optional
+	cassandraObserver struct {
+		metrics MetricsRecorder
+		tracer  trace.Tracer
+	}
+
+	// elasticTransport report latency and span of every HTTP request sent by the elastic client.
+	// metrics and tracer are each optional
+	elasticTransport struct {
+		metrics MetricsRecorder
+		tracer  trace.Tracer
+		next    http.RoundTripper
+	}
+)
+
+func (NoopMetrics) ObserveLatency(backend, command string, elapsed time.Duration, tags []string) {}
+
+func (NoopMetrics) SetGauge(backend, name string, value float64, tags []string) {}
+
+func (NoopMetrics) AddCounter(backend, name string, delta float64, tags []string) {}
+
+// statementType return lowercased first word of a CQL statement, such as select or insert
+func statementType(stmt string) string {
+	fields := strings.Fields(stmt)
+	if len(fields) <= 0 {
+		return "unknown"
+	}
+	return strings.ToLower(fields[0])
+}
+
+func (o cassandraObserver) ObserveQuery(ctx context.Context, q gocql.ObservedQuery) {
+	if o.tracer != nil {
+		o.traceQuery(ctx, q.Keyspace, statementType(q.Statement), sanitizeCQL(q.Statement), q.Host, q.Start, q.End, q.Err)
+	}
+	if o.metrics == nil {
+		return
+	}
+
+	tags := []string{"keyspace:" + q.Keyspace}
+	if q.Host != nil {
+		tags = append(tags, "ipcassandra:"+q.Host.ConnectAddress().String())
+	}
+	if q.Err != nil {
+		tags = append(tags, "error:true")
+	}
+	o.metrics.ObserveLatency("cassandra", statementType(q.Statement), q.End.Sub(q.Start), tags)
+}
+
+func (o cassandraObserver) ObserveBatch(ctx context.Context, b gocql.ObservedBatch) {
+	if o.tracer != nil {
+		var statements []string
+		for _, stmt := range b.Statements {
+			statements = append(statements, sanitizeCQL(stmt))
+		}
+		o.traceQuery(ctx, b.Keyspace, "batch", strings.Join(statements, "\n"), b.Host, b.Start, b.End, b.Err)
+	}
+	if o.metrics == nil {
+		return
+	}
+
+	tags := []string{"keyspace:" + b.Keyspace}
+	if b.Host != nil {
+		tags = append(tags, "ipcassandra:"+b.Host.ConnectAddress().String())
+	}
+	if b.Err != nil {
+		tags = append(tags, "error:true")
+	}
+	o.metrics.ObserveLatency("cassandra", "batch", b.End.Sub(b.Start), tags)
+}
+
+// elasticRequestType return the elastic endpoint of path, such as _search or _bulk, or the HTTP method
+// for document requests
+func elasticRequestType(r *http.Request) string {
+	for _, segment := range strings.Split(r.URL.Path, "/") {
+		if strings.HasPrefix(segment, "_") {
+			return segment
+		}
+	}
+	return strings.ToLower(r.Method)
+}
+
+func (t elasticTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	loggingStartTime := time.Now()
+
+	var span trace.Span
+	if t.tracer != nil {
+		r, span = t.startSpan(r)
+	}
+	resp, err := t.next.RoundTrip(r)
+	if span != nil {
+		endElasticSpan(span, resp, err)
+	}
+	if t.metrics == nil {
+		return resp, err
+	}
+
+	tags := []string{"ipelastic:" + r.URL.Host}
+	if err != nil || resp.StatusCode >= 500 {
+		tags = append(tags, "error:true")
+	}
+	t.metrics.ObserveLatency("elastic", elasticRequestType(r), time.Since(loggingStartTime), tags)
+	return resp, err
+}
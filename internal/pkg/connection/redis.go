@@ -1,53 +1,231 @@
 package connection
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
 	"time"
 
 	"github.com/garyburd/redigo/redis"
+	ddmetrics "github.com/loui58/odin/internal/pkg/metrics/datadog"
 	"github.com/tokopedia/r3/srcClean/datadog"
 )
 
-// NewRedis create new redis instance
+// NewRedis create new redis instance reporting latency to datadog, nil dd disable reporting
 func NewRedis(cfg RedisConfig, dd *datadog.DatadogInstance) (instance *RedisInstance, err error) {
+	if dd == nil {
+		return NewRedisWithMetrics(cfg, nil)
+	}
+	recorder := ddmetrics.New(dd)
+	instance, err = NewRedisWithMetrics(cfg, recorder)
+	if err != nil {
+		recorder.Close()
+		return
+	}
+	instance.ownMetrics = recorder
+	return
+}
+
+// NewRedisWithMetrics create new redis instance reporting latency to metrics, nil metrics disable reporting
+func NewRedisWithMetrics(cfg RedisConfig, metrics MetricsRecorder) (instance *RedisInstance, err error) {
+	cfg = withRedisDefaults(cfg)
 	instance = &RedisInstance{
 		RedisPool: nil,
 		Config:    cfg,
-		datadog:   dd,
+		scripts:   &redisScripts{},
+		waits:     &poolWaits{},
+		stop:      make(chan struct{}),
+	}
+	instance.SetMetrics(metrics)
+	if cfg.Breaker.ErrorRate > 0 || cfg.Breaker.SlowCall > 0 {
+		instance.breaker = newRedisBreaker(instance, cfg.Breaker)
+	}
+	instance.addBuiltinHooks()
+
+	if len(cfg.ClusterNodes) > 0 {
+		instance.cluster, err = newRedisCluster(instance.Config, instance.waits)
+		if err != nil {
+			instance.cluster.Close()
+			return
+		}
+	} else {
+		if cfg.SentinelMasterName != "" {
+			instance.sentinel = newRedisSentinel(instance.Config)
+			instance.RedisPool, err = instance.sentinel.pool()
+		} else {
+			instance.RedisPool, err = InitializeRedis(instance.Config)
+			if err == nil && len(cfg.ReplicaAddrs) > 0 {
+				instance.replicas, err = newRedisReplicas(instance.Config)
+			}
+		}
+		if err != nil {
+			if instance.RedisPool != nil {
+				instance.RedisPool.Close()
+			}
+			return
+		}
+		if len(cfg.NearCache.Prefixes) > 0 {
+			instance.near = newNearCache(instance, instance.RedisPool.Dial)
+		}
 	}
 
-	instance.RedisPool, err = InitializeRedis(instance.Config)
+	// background goroutines start once construction can no longer fail, so an error leave nothing running
+	if instance.sentinel != nil {
+		go instance.sentinel.watch()
+	}
+	if instance.near != nil {
+		go instance.near.watch()
+	}
+	if cfg.StatsInterval > 0 {
+		go instance.reportStats(cfg.StatsInterval)
+	}
 	return
 }
 
+// Close release every pooled connection of the instance. It does nothing on an instance made by WithPrefix,
+// close the instance it was derived from
+func (i *RedisInstance) Close() error {
+	if i.shared {
+		return nil
+	}
+	select {
+	case <-i.stop:
+	default:
+		close(i.stop)
+	}
+	if i.ownMetrics != nil {
+		i.ownMetrics.Close()
+	}
+	if i.cluster != nil {
+		return i.cluster.Close()
+	}
+	if i.sentinel != nil {
+		i.sentinel.Close()
+	}
+	if i.replicas != nil {
+		i.replicas.Close()
+	}
+	if i.near != nil {
+		i.near.Close()
+	}
+	return i.RedisPool.Close()
+}
+
+// SetDatadog report command latency to dd, nil dd disable reporting. The recorder made for dd is closed
+// with the instance
 func (i *RedisInstance) SetDatadog(dd *datadog.DatadogInstance) (err error) {
-	i.datadog = dd
+	if dd == nil {
+		return i.SetMetrics(nil)
+	}
+	recorder := ddmetrics.New(dd)
+	err = i.SetMetrics(recorder)
+	i.ownMetrics = recorder
+	return
+}
+
+// SetMetrics change where command latency is reported, nil disable reporting. metrics is not closed by Close
+func (i *RedisInstance) SetMetrics(metrics MetricsRecorder) (err error) {
+	if i.ownMetrics != nil {
+		i.ownMetrics.Close()
+		i.ownMetrics = nil
+	}
+	if metrics == nil {
+		metrics = NoopMetrics{}
+	}
+	i.metrics = metrics
 	return
 }
 
 // InitializeRedis create new redis connection. nb: Idle timeout is in second
+// When SentinelMasterName is set the pool follows the master elected by sentinel. The sentinel
+// watcher started here lives as long as the process, use NewRedis to be able to stop it with Close
 func InitializeRedis(cfg RedisConfig) (*redis.Pool, error) {
-	var err error
-	if cfg.IdleTimeout <= 0 {
-		cfg.IdleTimeout = 10
+	if cfg.SentinelMasterName != "" {
+		sentinel := newRedisSentinel(cfg)
+		go sentinel.watch()
+		return sentinel.pool()
 	}
-	if cfg.MaxActive < 0 {
-		cfg.MaxActive = 600
+	return newRedisPool(cfg, cfg.Connection)
+}
+
+// newRedisPool create pool of connection to addr using cfg pool settings
+func newRedisPool(cfg RedisConfig, addr string) (*redis.Pool, error) {
+	return newPool(cfg, func() (redis.Conn, error) {
+		return dialRedis(cfg, addr)
+	})
+}
+
+// dialRedis open one connection to addr, authenticated and set up as asked by cfg
+func dialRedis(cfg RedisConfig, addr string) (redis.Conn, error) {
+	cfg = withRedisDefaults(cfg)
+	options := []redis.DialOption{
+		redis.DialConnectTimeout(positive(cfg.DialTimeout)),
+		redis.DialReadTimeout(positive(cfg.ReadTimeout)),
+		redis.DialWriteTimeout(positive(cfg.WriteTimeout)),
 	}
-	if cfg.MaxIdle <= 0 {
-		cfg.MaxIdle = 3
+	if cfg.TLS {
+		tlsConfig, err := redisTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, redis.DialUseTLS(true), redis.DialTLSConfig(tlsConfig))
 	}
 
+	c, err := redis.Dial("tcp", addr, options...)
+	if err != nil {
+		return nil, err
+	}
+	if err = setupConn(c, cfg); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// positive return d, or 0 meaning no timeout for negative d
+func positive(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// dial open a connection outside the pool, for long lived usage such as pub/sub
+func (i *RedisInstance) dial() (redis.Conn, error) {
+	switch {
+	case i.cluster != nil:
+		return dialRedis(i.Config, i.cluster.nodeForSlot(0))
+	case i.sentinel != nil:
+		return i.sentinel.dial()
+	}
+	return dialRedis(i.Config, i.Config.Connection)
+}
+
+// newPool create pool of connection made by dial using cfg pool settings
+func newPool(cfg RedisConfig, dial func() (redis.Conn, error)) (*redis.Pool, error) {
+	var err error
+	cfg = withRedisDefaults(cfg)
+
 	redisPool := &redis.Pool{
 		Dial: func() (redis.Conn, error) {
-			c, errDial := redis.Dial("tcp", cfg.Connection)
+			c, errDial := dial()
 			if errDial != nil {
 				err = errDial
 				return nil, errDial
 			}
-			return c, nil
+			return &pooledConn{Conn: c, created: time.Now()}, nil
+		},
+		TestOnBorrow: func(c redis.Conn, lastUsed time.Time) error {
+			if pc, ok := c.(*pooledConn); ok && cfg.MaxConnLifetime > 0 && time.Since(pc.created) > cfg.MaxConnLifetime {
+				return errRedisConnExpired
+			}
+			if cfg.HealthCheckInterval < 0 || time.Since(lastUsed) < cfg.HealthCheckInterval {
+				return nil
+			}
+			_, errPing := c.Do("PING")
+			return errPing
 		},
 		IdleTimeout: time.Duration(cfg.IdleTimeout) * time.Second,
 		MaxActive:   cfg.MaxActive,
@@ -57,255 +235,341 @@ func InitializeRedis(cfg RedisConfig) (*redis.Pool, error) {
 	return redisPool, err
 }
 
-/*H Command*/
-func (i *RedisInstance) HGetAll(key string, datadogAdditionalInfo map[string]string) (result map[string]string, err error) {
-	loggingStartTime := time.Now()
-
-	rdsConn := i.RedisPool.Get()
-	result, err = redis.StringMap(rdsConn.Do("HGETALL", key))
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		err = errRdsConn
-
-		return
+// withRedisDefaults fill unset pool and timeout settings of cfg
+func withRedisDefaults(cfg RedisConfig) RedisConfig {
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = 10
 	}
-
-	tags := []string{fmt.Sprintf("type:%s", "hgetall")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
+	if cfg.MaxActive <= 0 {
+		cfg.MaxActive = 600
 	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
-	return
+	if cfg.MaxIdle <= 0 {
+		cfg.MaxIdle = 3
+	}
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = 5 * time.Second
+	}
+	if cfg.ReadTimeout == 0 {
+		cfg.ReadTimeout = 3 * time.Second
+	}
+	if cfg.WriteTimeout == 0 {
+		cfg.WriteTimeout = 3 * time.Second
+	}
+	if cfg.PoolWaitTimeout == 0 {
+		cfg.PoolWaitTimeout = time.Second
+		if cfg.ReadTimeout > 0 {
+			cfg.PoolWaitTimeout += cfg.ReadTimeout
+		}
+	}
+	if cfg.MaxConnLifetime == 0 {
+		cfg.MaxConnLifetime = 30 * time.Minute
+	}
+	if cfg.HealthCheckInterval == 0 {
+		cfg.HealthCheckInterval = time.Minute
+	}
+	if cfg.StatsInterval == 0 {
+		cfg.StatsInterval = 10 * time.Second
+	}
+	return cfg
 }
 
-func (i *RedisInstance) HLen(key string, datadogAdditionalInfo map[string]string) (result int, err error) {
-	loggingStartTime := time.Now()
+// pooledConn remember when a pooled connection was dialed, to enforce MaxConnLifetime
+type pooledConn struct {
+	redis.Conn
+	created time.Time
+}
 
-	resultInt64 := int64(0)
-	rdsConn := i.RedisPool.Get()
-	resultInt64, err = redis.Int64(rdsConn.Do("HLEN", key))
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		err = errRdsConn
+// pooledConnRef is the only argument of an empty Do made to find the pooledConn behind a pool connection
+type pooledConnRef struct {
+	conn *pooledConn
+}
 
-		return
-	}
-	result = int(resultInt64)
+// pooledConnOf return the pooledConn c is borrowed from, nil when c does not come from a pool made by newPool.
+// The empty Do reaching pooledConn is answered without any I/O
+func pooledConnOf(c redis.Conn) *pooledConn {
+	ref := &pooledConnRef{}
+	c.Do("", ref)
+	return ref.conn
+}
 
-	tags := []string{fmt.Sprintf("type:%s", "hlen")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
+func (c *pooledConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd == "" && len(args) == 1 {
+		if ref, ok := args[0].(*pooledConnRef); ok {
+			ref.conn = c
+			return nil, nil
+		}
 	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
-	return
+	return c.Conn.Do(cmd, args...)
 }
 
-func (i *RedisInstance) HGet(key, field string, datadogAdditionalInfo map[string]string) (result string, err error) {
-	loggingStartTime := time.Now()
+// interrupt close the connection from another goroutine, failing the command in flight. The connection stay
+// broken so the pool close it instead of keeping it idle
+func (c *pooledConn) interrupt() {
+	c.Conn.Close()
+}
 
-	resultTmp := []byte{}
-	rdsConn := i.RedisPool.Get()
-	resultTmp, err = redis.Bytes(rdsConn.Do("HGET", key, field))
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		err = errRdsConn
+func (c *pooledConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	return redis.DoWithTimeout(c.Conn, timeout, cmd, args...)
+}
 
-		return
+func (c *pooledConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redis.ReceiveWithTimeout(c.Conn, timeout)
+}
+
+// getPooled take a connection of pool, waiting at most waitTimeout for a free one when every connection is in
+// use. Such waits are counted in waits when it is not nil
+func getPooled(ctx context.Context, pool *redis.Pool, waitTimeout time.Duration, waits *poolWaits) (redis.Conn, error) {
+	if waits != nil && pool.MaxActive > 0 && pool.ActiveCount() >= pool.MaxActive {
+		defer waits.observe(time.Now())
 	}
 
-	if err == redis.ErrNil {
-		return "", nil
-	} else if err != nil {
-		return "", err
+	waitCtx := ctx
+	if waitTimeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, waitTimeout)
+		defer cancel()
 	}
 
-	if resultTmp != nil {
-		result = string(resultTmp)
+	c, err := pool.GetContext(waitCtx)
+	if err == nil {
+		return c, nil
 	}
+	if errCtx := ctxErr(ctx); errCtx != nil {
+		return nil, errCtx
+	}
+	if err == context.DeadlineExceeded || err == redis.ErrPoolExhausted {
+		return nil, ErrRedisPoolExhausted
+	}
+	return nil, err
+}
 
-	tags := []string{fmt.Sprintf("type:%s", "hget")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
+var (
+	// ErrRedisCanceled is returned when the caller context is canceled before the command completes
+	ErrRedisCanceled = errors.New("[error][redis] command canceled")
+	// ErrRedisDeadlineExceeded is returned when the caller context deadline passes before the command completes
+	ErrRedisDeadlineExceeded = errors.New("[error][redis] command deadline exceeded")
+	// ErrRedisPoolExhausted is returned when every connection stayed in use for Config.PoolWaitTimeout
+	ErrRedisPoolExhausted = errors.New("[error][redis] connection pool exhausted")
+
+	errRedisConnExpired = errors.New("[error][redis] connection reached MaxConnLifetime")
+)
+
+// ctxErr translate context error into redis error
+func ctxErr(ctx context.Context) error {
+	switch ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return ErrRedisDeadlineExceeded
+	default:
+		return ErrRedisCanceled
 	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
-	return
 }
 
-func (i *RedisInstance) HSet(key, field string, value string, datadogAdditionalInfo map[string]string) (err error) {
-	loggingStartTime := time.Now()
+// getConn take connection from pool, giving up when ctx is done or PoolWaitTimeout passed while waiting for a
+// free connection
+func (i *RedisInstance) getConn(ctx context.Context) (redis.Conn, error) {
+	if err := ctxErr(ctx); err != nil {
+		return nil, err
+	}
+	if i.cluster != nil {
+		return i.cluster.conn(ctx), nil
+	}
+	return getPooled(ctx, i.RedisPool, i.Config.PoolWaitTimeout, i.waits)
+}
 
-	rdsConn := i.RedisPool.Get()
-	_, err = rdsConn.Do("HSET", key, field, value)
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		err = errRdsConn
+// doCtx run command on c, a connection of a pool made by newPool or of the cluster. Read deadline is taken from
+// ctx, and when ctx is done while the command is in flight the connection is closed, so the caller is released
+// at once and the pool discard the connection when it is given back
+func doCtx(ctx context.Context, c redis.Conn, cmd string, args ...interface{}) (reply interface{}, err error) {
+	if err = ctxErr(ctx); err != nil {
+		return nil, err
+	}
+	if cc, ok := c.(*clusterConn); ok {
+		// cluster connection pick its node connection per command, each one is watched on its own
+		return cc.do(func(c redis.Conn, cmd string, args ...interface{}) (interface{}, error) {
+			return doConnCtx(ctx, c, cmd, args...)
+		}, cmd, args...)
+	}
+	return doConnCtx(ctx, c, cmd, args...)
+}
 
-		return
+func doConnCtx(ctx context.Context, c redis.Conn, cmd string, args ...interface{}) (reply interface{}, err error) {
+	if err = ctxErr(ctx); err != nil {
+		return nil, err
 	}
 
+	pc := pooledConnOf(c)
+	if done := ctx.Done(); done != nil && pc != nil {
+		finished := make(chan struct{})
+		watched := make(chan struct{})
+		go func() {
+			defer close(watched)
+			select {
+			case <-done:
+				pc.interrupt()
+			case <-finished:
+			}
+		}()
+		defer func() {
+			close(finished)
+			<-watched
+		}()
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		reply, err = c.Do(cmd, args...)
+	} else if timeout := time.Until(deadline); timeout > 0 {
+		reply, err = redis.DoWithTimeout(c, timeout, cmd, args...)
+	} else {
+		return nil, ErrRedisDeadlineExceeded
+	}
 	if err != nil {
-		return err
+		if errCtx := ctxErr(ctx); errCtx != nil {
+			return nil, errCtx
+		}
 	}
+	return
+}
 
-	tags := []string{fmt.Sprintf("type:%s", "hset")}
+// histogram report command latency to the metrics recorder, tagged with redis address
+func (i *RedisInstance) histogram(cmdType string, loggingStartTime time.Time, datadogAdditionalInfo map[string]string, extraTags ...string) {
+	if i.metrics == nil {
+		return
+	}
+	var tags []string
 	for k, v := range datadogAdditionalInfo {
 		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
 	}
+	tags = append(tags, extraTags...)
 	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
+	if i.Config.Namespace != "" {
+		tags = append(tags, "namespace:"+i.Config.Namespace)
+	}
+	i.metrics.ObserveLatency("redis", cmdType, time.Since(loggingStartTime), tags)
+}
+
+/*H Command*/
+func (i *RedisInstance) HGetAll(key string, datadogAdditionalInfo map[string]string) (result map[string]string, err error) {
+	return i.HGetAllCtx(context.Background(), key, datadogAdditionalInfo)
+}
+
+// HGetAllCtx is HGetAll bounded by ctx
+func (i *RedisInstance) HGetAllCtx(ctx context.Context, key string, datadogAdditionalInfo map[string]string) (result map[string]string, err error) {
+	return redis.StringMap(i.run(ctx, "hgetall", datadogAdditionalInfo, "HGETALL", key))
+}
+
+func (i *RedisInstance) HLen(key string, datadogAdditionalInfo map[string]string) (result int, err error) {
+	return i.HLenCtx(context.Background(), key, datadogAdditionalInfo)
+}
+
+// HLenCtx is HLen bounded by ctx
+func (i *RedisInstance) HLenCtx(ctx context.Context, key string, datadogAdditionalInfo map[string]string) (result int, err error) {
+	return redis.Int(i.run(ctx, "hlen", datadogAdditionalInfo, "HLEN", key))
+}
+
+func (i *RedisInstance) HGet(key, field string, datadogAdditionalInfo map[string]string) (result string, err error) {
+	return i.HGetCtx(context.Background(), key, field, datadogAdditionalInfo)
+}
+
+// HGetCtx is HGet bounded by ctx
+func (i *RedisInstance) HGetCtx(ctx context.Context, key, field string, datadogAdditionalInfo map[string]string) (result string, err error) {
+	result, err = redis.String(i.run(ctx, "hget", datadogAdditionalInfo, "HGET", key, field))
+	if err == redis.ErrNil {
+		return "", nil
+	}
+	return
+}
+
+func (i *RedisInstance) HSet(key, field string, value string, datadogAdditionalInfo map[string]string) (err error) {
+	return i.HSetCtx(context.Background(), key, field, value, datadogAdditionalInfo)
+}
+
+// HSetCtx is HSet bounded by ctx
+func (i *RedisInstance) HSetCtx(ctx context.Context, key, field string, value string, datadogAdditionalInfo map[string]string) (err error) {
+	_, err = i.run(ctx, "hset", datadogAdditionalInfo, "HSET", key, field, value)
 	return
 }
 func (i *RedisInstance) HMGet(key string, fields []string, datadogAdditionalInfo map[string]string) (result map[string]string, err error) {
-	loggingStartTime := time.Now()
+	return i.HMGetCtx(context.Background(), key, fields, datadogAdditionalInfo)
+}
 
+// HMGetCtx is HMGet bounded by ctx
+func (i *RedisInstance) HMGetCtx(ctx context.Context, key string, fields []string, datadogAdditionalInfo map[string]string) (result map[string]string, err error) {
 	result = make(map[string]string)
-	if len(fields) > 0 {
-		var pairsValInterface []interface{}
-		pairsValInterface = append(pairsValInterface, key)
-		for _, f := range fields {
-			pairsValInterface = append(pairsValInterface, f)
-		}
-		resultTmp := []string{}
-		rdsConn := i.RedisPool.Get()
-		resultTmp, err = redis.Strings(rdsConn.Do("HMGET", pairsValInterface...))
-		errRdsConn := rdsConn.Close()
-		if errRdsConn != nil {
-			err = errRdsConn
-
-			return
-		}
-		for i, f := range fields {
-			if len(resultTmp) > i {
-				result[f] = resultTmp[i]
-			}
-		}
+	if len(fields) <= 0 {
+		return
 	}
 
-	tags := []string{fmt.Sprintf("type:%s", "hmget")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
+	var pairsValInterface []interface{}
+	pairsValInterface = append(pairsValInterface, key)
+	for _, f := range fields {
+		pairsValInterface = append(pairsValInterface, f)
+	}
+	resultTmp, err := redis.Strings(i.run(ctx, "hmget", datadogAdditionalInfo, "HMGET", pairsValInterface...))
+	for i, f := range fields {
+		if len(resultTmp) > i {
+			result[f] = resultTmp[i]
+		}
 	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
 	return
 }
 func (i *RedisInstance) HMSet(key string, pairs map[string]string, datadogAdditionalInfo map[string]string) (err error) {
-	loggingStartTime := time.Now()
-
-	if len(pairs) > 0 {
-		var pairsValInterface []interface{}
-		pairsValInterface = append(pairsValInterface, key)
-		for k, v := range pairs {
-			pairsValInterface = append(pairsValInterface, k, v)
-		}
-		rdsConn := i.RedisPool.Get()
-		_, err = rdsConn.Do("HMSET", pairsValInterface...)
-		errRdsConn := rdsConn.Close()
-		if errRdsConn != nil {
-			err = errRdsConn
+	return i.HMSetCtx(context.Background(), key, pairs, datadogAdditionalInfo)
+}
 
-			return
-		}
-		if err != nil {
-			return err
-		}
+// HMSetCtx is HMSet bounded by ctx
+func (i *RedisInstance) HMSetCtx(ctx context.Context, key string, pairs map[string]string, datadogAdditionalInfo map[string]string) (err error) {
+	if len(pairs) <= 0 {
+		return
 	}
 
-	tags := []string{fmt.Sprintf("type:%s", "hmset")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
+	var pairsValInterface []interface{}
+	pairsValInterface = append(pairsValInterface, key)
+	for k, v := range pairs {
+		pairsValInterface = append(pairsValInterface, k, v)
 	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
+	_, err = i.run(ctx, "hmset", datadogAdditionalInfo, "HMSET", pairsValInterface...)
 	return
 }
 
 func (i *RedisInstance) HDel(key string, members []string, datadogAdditionalInfo map[string]string) (err error) {
-	loggingStartTime := time.Now()
+	return i.HDelCtx(context.Background(), key, members, datadogAdditionalInfo)
+}
 
+// HDelCtx is HDel bounded by ctx
+func (i *RedisInstance) HDelCtx(ctx context.Context, key string, members []string, datadogAdditionalInfo map[string]string) (err error) {
 	var datas []interface{}
 	datas = append(datas, key)
 	for _, m := range members {
 		datas = append(datas, m)
 	}
-	rdsConn := i.RedisPool.Get()
-	_, err = rdsConn.Do("HDEL", datas...)
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		err = errRdsConn
-
-		return
-	}
-	if err == redis.ErrNil {
-		err = nil
-	}
-	tags := []string{fmt.Sprintf("type:%s", "hdel")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
-	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
+	_, err = i.run(ctx, "hdel", datadogAdditionalInfo, "HDEL", datas...)
 	return
 }
 
 /*Z Command*/
 
 func (i *RedisInstance) ZScore(key, member string, datadogAdditionalInfo map[string]string) (result float64, err error) {
-	loggingStartTime := time.Now()
-
-	rdsConn := i.RedisPool.Get()
-	result, err = redis.Float64(rdsConn.Do("ZSCORE", key, member))
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		err = errRdsConn
-
-		return
-	}
+	return i.ZScoreCtx(context.Background(), key, member, datadogAdditionalInfo)
+}
 
+// ZScoreCtx is ZScore bounded by ctx
+func (i *RedisInstance) ZScoreCtx(ctx context.Context, key, member string, datadogAdditionalInfo map[string]string) (result float64, err error) {
+	result, err = redis.Float64(i.run(ctx, "zscore", datadogAdditionalInfo, "ZSCORE", key, member))
 	if err == redis.ErrNil {
-		err = nil
-		result = 0
-	}
-
-	tags := []string{fmt.Sprintf("type:%s", "zscore")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
+		return 0, nil
 	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
 	return
 }
 
 func (i *RedisInstance) ZAdd(key string, pairs map[string]float64, datadogAdditionalInfo map[string]string) (result int, err error) {
-	loggingStartTime := time.Now()
+	return i.ZAddCtx(context.Background(), key, pairs, datadogAdditionalInfo)
+}
 
+// ZAddCtx is ZAdd bounded by ctx
+func (i *RedisInstance) ZAddCtx(ctx context.Context, key string, pairs map[string]float64, datadogAdditionalInfo map[string]string) (result int, err error) {
 	if len(pairs) <= 0 {
 		return
 	}
@@ -315,181 +579,69 @@ func (i *RedisInstance) ZAdd(key string, pairs map[string]float64, datadogAdditi
 	for k, v := range pairs {
 		pairsValInterface = append(pairsValInterface, v, k)
 	}
-
-	r := int64(0)
-	rdsConn := i.RedisPool.Get()
-	r, err = redis.Int64(rdsConn.Do("ZADD", pairsValInterface...))
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		err = errRdsConn
-
-		return
-	}
-
-	if err == nil {
-		result = int(r)
-	}
-
-	tags := []string{fmt.Sprintf("type:%s", "zadd")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
-	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
-	return
+	return redis.Int(i.run(ctx, "zadd", datadogAdditionalInfo, "ZADD", pairsValInterface...))
 }
 
 func (i *RedisInstance) ZIncrBy(key string, increment float64, member string, datadogAdditionalInfo map[string]string) (err error) {
-	loggingStartTime := time.Now()
-
-	rdsConn := i.RedisPool.Get()
-	_, err = rdsConn.Do("ZINCRBY", key, increment, member)
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		err = errRdsConn
-
-		return
-	}
+	return i.ZIncrByCtx(context.Background(), key, increment, member, datadogAdditionalInfo)
+}
 
-	tags := []string{fmt.Sprintf("type:%s", "zincrby")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
-	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
+// ZIncrByCtx is ZIncrBy bounded by ctx
+func (i *RedisInstance) ZIncrByCtx(ctx context.Context, key string, increment float64, member string, datadogAdditionalInfo map[string]string) (err error) {
+	_, err = i.run(ctx, "zincrby", datadogAdditionalInfo, "ZINCRBY", key, increment, member)
 	return
 }
 
 func (i *RedisInstance) ZRevRangeByScore(key, max, min string, datadogAdditionalInfo map[string]string) (result []string, err error) {
-	loggingStartTime := time.Now()
-
-	rdsConn := i.RedisPool.Get()
-	result, err = redis.Strings(rdsConn.Do("ZREVRANGEBYSCORE", key, max, min))
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		err = errRdsConn
-
-		return
-	}
+	return i.ZRevRangeByScoreCtx(context.Background(), key, max, min, datadogAdditionalInfo)
+}
 
-	tags := []string{fmt.Sprintf("type:%s", "zrevrangebyscore")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
-	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
-	return
+// ZRevRangeByScoreCtx is ZRevRangeByScore bounded by ctx
+func (i *RedisInstance) ZRevRangeByScoreCtx(ctx context.Context, key, max, min string, datadogAdditionalInfo map[string]string) (result []string, err error) {
+	return redis.Strings(i.run(ctx, "zrevrangebyscore", datadogAdditionalInfo, "ZREVRANGEBYSCORE", key, max, min))
 }
 
 func (i *RedisInstance) ZRevRange(key string, start, stop int, datadogAdditionalInfo map[string]string) (result []string, err error) {
-	loggingStartTime := time.Now()
-
-	rdsConn := i.RedisPool.Get()
-	result, err = redis.Strings(rdsConn.Do("ZREVRANGE", key, start, stop))
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		err = errRdsConn
-
-		return
-	}
+	return i.ZRevRangeCtx(context.Background(), key, start, stop, datadogAdditionalInfo)
+}
 
-	tags := []string{fmt.Sprintf("type:%s", "zrevrange")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
-	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
-	return
+// ZRevRangeCtx is ZRevRange bounded by ctx
+func (i *RedisInstance) ZRevRangeCtx(ctx context.Context, key string, start, stop int, datadogAdditionalInfo map[string]string) (result []string, err error) {
+	return redis.Strings(i.run(ctx, "zrevrange", datadogAdditionalInfo, "ZREVRANGE", key, start, stop))
 }
 
 func (i *RedisInstance) ZRevRangeWithscores(key string, start, stop int, datadogAdditionalInfo map[string]string) (result map[string]float64, err error) {
-	loggingStartTime := time.Now()
-	result = make(map[string]float64)
-	redisResult := []string{}
-	rdsConn := i.RedisPool.Get()
-	redisResult, err = redis.Strings(rdsConn.Do("ZREVRANGE", key, start, stop, "WITHSCORES"))
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		err = errRdsConn
-
-		return
-	}
-	currentKey := ""
-	for i, r := range redisResult {
-		if i%2 == 0 {
-			currentKey = r
-		} else {
-			currentScore, errParse := strconv.ParseFloat(r, 64)
-			if errParse != nil {
-				log.Println("[warning]", errParse)
-				continue
-			}
-			result[currentKey] = currentScore
-		}
-	}
+	return i.ZRevRangeWithscoresCtx(context.Background(), key, start, stop, datadogAdditionalInfo)
+}
 
-	tags := []string{fmt.Sprintf("type:%s", "zrevrange_withscores")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
-	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
-	return
+// ZRevRangeWithscoresCtx is ZRevRangeWithscores bounded by ctx
+func (i *RedisInstance) ZRevRangeWithscoresCtx(ctx context.Context, key string, start, stop int, datadogAdditionalInfo map[string]string) (result map[string]float64, err error) {
+	redisResult, err := redis.Strings(i.run(ctx, "zrevrange_withscores", datadogAdditionalInfo, "ZREVRANGE", key, start, stop, "WITHSCORES"))
+	return parseWithscores(redisResult), err
 }
 
 func (i *RedisInstance) ZRange(key string, start, stop int, datadogAdditionalInfo map[string]string) (result []string, err error) {
-	loggingStartTime := time.Now()
-
-	rdsConn := i.RedisPool.Get()
-	result, err = redis.Strings(rdsConn.Do("ZRANGE", key, start, stop))
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		err = errRdsConn
-
-		return
-	}
+	return i.ZRangeCtx(context.Background(), key, start, stop, datadogAdditionalInfo)
+}
 
-	tags := []string{fmt.Sprintf("type:%s", "zrange")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
-	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
-	return
+// ZRangeCtx is ZRange bounded by ctx
+func (i *RedisInstance) ZRangeCtx(ctx context.Context, key string, start, stop int, datadogAdditionalInfo map[string]string) (result []string, err error) {
+	return redis.Strings(i.run(ctx, "zrange", datadogAdditionalInfo, "ZRANGE", key, start, stop))
 }
 
 func (i *RedisInstance) ZRangeWithscores(key string, start, stop int, datadogAdditionalInfo map[string]string) (result map[string]float64, err error) {
-	loggingStartTime := time.Now()
-	result = make(map[string]float64)
-	redisResult := []string{}
-
-	rdsConn := i.RedisPool.Get()
-	redisResult, err = redis.Strings(rdsConn.Do("ZRANGE", key, start, stop, "WITHSCORES"))
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		err = errRdsConn
+	return i.ZRangeWithscoresCtx(context.Background(), key, start, stop, datadogAdditionalInfo)
+}
 
-		return
-	}
+// ZRangeWithscoresCtx is ZRangeWithscores bounded by ctx
+func (i *RedisInstance) ZRangeWithscoresCtx(ctx context.Context, key string, start, stop int, datadogAdditionalInfo map[string]string) (result map[string]float64, err error) {
+	redisResult, err := redis.Strings(i.run(ctx, "zrange_withscores", datadogAdditionalInfo, "ZRANGE", key, start, stop, "WITHSCORES"))
+	return parseWithscores(redisResult), err
+}
 
+// parseWithscores read member score pairs of a WITHSCORES reply
+func parseWithscores(redisResult []string) map[string]float64 {
+	result := make(map[string]float64)
 	currentKey := ""
 	for i, r := range redisResult {
 		if i%2 == 0 {
@@ -503,484 +655,206 @@ func (i *RedisInstance) ZRangeWithscores(key string, start, stop int, datadogAdd
 			result[currentKey] = currentScore
 		}
 	}
-
-	tags := []string{fmt.Sprintf("type:%s", "zrange_withscores")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
-	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
-	return
+	return result
 }
-func (i *RedisInstance) ZRangeByScore(key, min, max string, datadogAdditionalInfo map[string]string) (result []string, err error) {
-	loggingStartTime := time.Now()
 
-	rdsConn := i.RedisPool.Get()
-	result, err = redis.Strings(rdsConn.Do("ZRANGEBYSCORE", key, min, max))
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		err = errRdsConn
-
-		return
-	}
+func (i *RedisInstance) ZRangeByScore(key, min, max string, datadogAdditionalInfo map[string]string) (result []string, err error) {
+	return i.ZRangeByScoreCtx(context.Background(), key, min, max, datadogAdditionalInfo)
+}
 
-	tags := []string{fmt.Sprintf("type:%s", "zrangebyscore")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
-	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
-	return
+// ZRangeByScoreCtx is ZRangeByScore bounded by ctx
+func (i *RedisInstance) ZRangeByScoreCtx(ctx context.Context, key, min, max string, datadogAdditionalInfo map[string]string) (result []string, err error) {
+	return redis.Strings(i.run(ctx, "zrangebyscore", datadogAdditionalInfo, "ZRANGEBYSCORE", key, min, max))
 }
 
 func (i *RedisInstance) ZRem(key string, members []string, datadogAdditionalInfo map[string]string) (err error) {
-	loggingStartTime := time.Now()
+	return i.ZRemCtx(context.Background(), key, members, datadogAdditionalInfo)
+}
 
+// ZRemCtx is ZRem bounded by ctx
+func (i *RedisInstance) ZRemCtx(ctx context.Context, key string, members []string, datadogAdditionalInfo map[string]string) (err error) {
 	var datas []interface{}
 	datas = append(datas, key)
 	for _, m := range members {
 		datas = append(datas, m)
 	}
-
-	rdsConn := i.RedisPool.Get()
-	_, err = rdsConn.Do("ZREM", datas...)
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		err = errRdsConn
-
-		return
-	}
-
-	if err == redis.ErrNil {
-		err = nil
-	}
-
-	tags := []string{fmt.Sprintf("type:%s", "zrem")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
-	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
+	_, err = i.run(ctx, "zrem", datadogAdditionalInfo, "ZREM", datas...)
 	return
 }
 
 func (i *RedisInstance) ZCount(key, min, max string, datadogAdditionalInfo map[string]string) (result int, err error) {
-	loggingStartTime := time.Now()
-
-	var tmpResult int64
-	rdsConn := i.RedisPool.Get()
-	tmpResult, err = redis.Int64(rdsConn.Do("ZCOUNT", key, min, max))
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		err = errRdsConn
-
-		return
-	}
-	if err == nil {
-		result = int(tmpResult)
-	}
+	return i.ZCountCtx(context.Background(), key, min, max, datadogAdditionalInfo)
+}
 
-	tags := []string{fmt.Sprintf("type:%s", "zcount")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
-	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
-	return
+// ZCountCtx is ZCount bounded by ctx
+func (i *RedisInstance) ZCountCtx(ctx context.Context, key, min, max string, datadogAdditionalInfo map[string]string) (result int, err error) {
+	return redis.Int(i.run(ctx, "zcount", datadogAdditionalInfo, "ZCOUNT", key, min, max))
 }
 
 func (i *RedisInstance) SAdd(key string, members []string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error) {
-	loggingStartTime := time.Now()
-	if len(members) > 0 {
-		var pairsValInterface []interface{}
-		pairsValInterface = append(pairsValInterface, key)
-		for _, v := range members {
-			pairsValInterface = append(pairsValInterface, v)
-		}
+	return i.SAddCtx(context.Background(), key, members, expireSeconds, datadogAdditionalInfo)
+}
 
-		rdsConn := i.RedisPool.Get()
-		_, err = rdsConn.Do("SADD", pairsValInterface...)
-		errRdsConn := rdsConn.Close()
-		if errRdsConn != nil {
-			err = errRdsConn
+// SAddCtx is SAdd bounded by ctx
+func (i *RedisInstance) SAddCtx(ctx context.Context, key string, members []string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error) {
+	return i.pushWithExpire(ctx, "sadd", "SADD", key, members, expireSeconds, datadogAdditionalInfo)
+}
 
-			return
-		}
-		if err == nil {
-			if expireSeconds > 0 {
-				rdsConn = i.RedisPool.Get()
-				_, err = rdsConn.Do("EXPIRE", key, expireSeconds)
-				errRdsConn := rdsConn.Close()
-				if errRdsConn != nil {
-					err = errRdsConn
-
-					return
-				}
-
-				if err != nil {
-					return err
-				}
-			}
-		}
-		if err != nil {
-			return err
-		}
+// pushWithExpire add members to key with cmd. With expireSeconds, cmd and EXPIRE go in one MULTI/EXEC so
+// the key is never left without ttl
+func (i *RedisInstance) pushWithExpire(ctx context.Context, cmdType, cmd, key string, members []string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error) {
+	if len(members) <= 0 {
+		return
 	}
 
-	tags := []string{fmt.Sprintf("type:%s", "sadd")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
+	var pairsValInterface []interface{}
+	pairsValInterface = append(pairsValInterface, key)
+	for _, v := range members {
+		pairsValInterface = append(pairsValInterface, v)
 	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
+	if expireSeconds > 0 {
+		return i.runMulti(ctx, cmdType, datadogAdditionalInfo, []pipelined{
+			newPipelineStatus(cmd, pairsValInterface...),
+			newPipelineStatus("EXPIRE", key, expireSeconds),
+		})
+	}
+	_, err = i.run(ctx, cmdType, datadogAdditionalInfo, cmd, pairsValInterface...)
 	return
 }
 
 func (i *RedisInstance) IsExist(key string, datadogAdditionalInfo map[string]string) (bool, error) {
-	loggingStartTime := time.Now()
-
-	rdsConn := i.RedisPool.Get()
-	results, err := redis.Int64(rdsConn.Do("EXISTS", key))
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		return false, errRdsConn
-	}
+	return i.IsExistCtx(context.Background(), key, datadogAdditionalInfo)
+}
 
+// IsExistCtx is IsExist bounded by ctx
+func (i *RedisInstance) IsExistCtx(ctx context.Context, key string, datadogAdditionalInfo map[string]string) (bool, error) {
+	results, err := redis.Int64(i.run(ctx, "exists", datadogAdditionalInfo, "EXISTS", key))
 	if err != nil {
 		return false, err
 	}
-
-	tags := []string{fmt.Sprintf("type:%s", "exists")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
-	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
-	return results > 0, err
+	return results > 0, nil
 }
 
 func (i *RedisInstance) SMembers(key string, datadogAdditionalInfo map[string]string) ([]string, error) {
-	loggingStartTime := time.Now()
-
-	rdsConn := i.RedisPool.Get()
-	results, err := redis.Strings(rdsConn.Do("SMEMBERS", key))
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		return []string{}, errRdsConn
-	}
+	return i.SMembersCtx(context.Background(), key, datadogAdditionalInfo)
+}
 
-	tags := []string{fmt.Sprintf("type:%s", "smembers")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
-	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
-	return results, err
+// SMembersCtx is SMembers bounded by ctx
+func (i *RedisInstance) SMembersCtx(ctx context.Context, key string, datadogAdditionalInfo map[string]string) ([]string, error) {
+	return redis.Strings(i.run(ctx, "smembers", datadogAdditionalInfo, "SMEMBERS", key))
 }
 
 func (i *RedisInstance) RPush(key string, members []string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error) {
-	loggingStartTime := time.Now()
-	if len(members) > 0 {
-		var pairsValInterface []interface{}
-		pairsValInterface = append(pairsValInterface, key)
-		for _, v := range members {
-			pairsValInterface = append(pairsValInterface, v)
-		}
-
-		rdsConn := i.RedisPool.Get()
-		_, err = rdsConn.Do("RPUSH", pairsValInterface...)
-		errRdsConn := rdsConn.Close()
-		if errRdsConn != nil {
-			err = errRdsConn
-
-			return
-		}
-		if err == nil {
-			if expireSeconds > 0 {
-				rdsConn = i.RedisPool.Get()
-				_, err = rdsConn.Do("EXPIRE", key, expireSeconds)
-				errRdsConn := rdsConn.Close()
-				if errRdsConn != nil {
-					err = errRdsConn
-
-					return
-				}
-				if err != nil {
-					return err
-				}
-			}
-		}
-		if err != nil {
-			return err
-		}
-	}
+	return i.RPushCtx(context.Background(), key, members, expireSeconds, datadogAdditionalInfo)
+}
 
-	tags := []string{fmt.Sprintf("type:%s", "rpush")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
-	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
-	return
+// RPushCtx is RPush bounded by ctx
+func (i *RedisInstance) RPushCtx(ctx context.Context, key string, members []string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error) {
+	return i.pushWithExpire(ctx, "rpush", "RPUSH", key, members, expireSeconds, datadogAdditionalInfo)
 }
 
 func (i *RedisInstance) LPush(key string, members []string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error) {
-	loggingStartTime := time.Now()
-	if len(members) > 0 {
-		var pairsValInterface []interface{}
-		pairsValInterface = append(pairsValInterface, key)
-		for _, v := range members {
-			pairsValInterface = append(pairsValInterface, v)
-		}
-
-		rdsConn := i.RedisPool.Get()
-		_, err = rdsConn.Do("LPUSH", pairsValInterface...)
-		errRdsConn := rdsConn.Close()
-		if errRdsConn != nil {
-			err = errRdsConn
-
-			return
-		}
-		if err == nil {
-			if expireSeconds > 0 {
-				rdsConn = i.RedisPool.Get()
-				_, err = rdsConn.Do("EXPIRE", key, expireSeconds)
-				errRdsConn := rdsConn.Close()
-				if errRdsConn != nil {
-					err = errRdsConn
-
-					return
-				}
-				if err != nil {
-					return err
-				}
-			}
-		}
-		if err != nil {
-			return err
-		}
-	}
+	return i.LPushCtx(context.Background(), key, members, expireSeconds, datadogAdditionalInfo)
+}
 
-	tags := []string{fmt.Sprintf("type:%s", "lpush")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
-	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
-	return
+// LPushCtx is LPush bounded by ctx
+func (i *RedisInstance) LPushCtx(ctx context.Context, key string, members []string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error) {
+	return i.pushWithExpire(ctx, "lpush", "LPUSH", key, members, expireSeconds, datadogAdditionalInfo)
 }
 
 func (i *RedisInstance) LRem(key string, count int, value string, datadogAdditionalInfo map[string]string) (err error) {
-	loggingStartTime := time.Now()
-
-	rdsConn := i.RedisPool.Get()
-	_, err = rdsConn.Do("LREM", key, count, value)
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		err = errRdsConn
-
-		return
-	}
+	return i.LRemCtx(context.Background(), key, count, value, datadogAdditionalInfo)
+}
 
-	tags := []string{fmt.Sprintf("type:%s", "lrem")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
-	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
+// LRemCtx is LRem bounded by ctx
+func (i *RedisInstance) LRemCtx(ctx context.Context, key string, count int, value string, datadogAdditionalInfo map[string]string) (err error) {
+	_, err = i.run(ctx, "lrem", datadogAdditionalInfo, "LREM", key, count, value)
 	return
 }
 func (i *RedisInstance) LTrim(key string, start, stop int, datadogAdditionalInfo map[string]string) (err error) {
-	loggingStartTime := time.Now()
-
-	rdsConn := i.RedisPool.Get()
-	_, err = rdsConn.Do("LTRIM", key, start, stop)
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		err = errRdsConn
-
-		return
-	}
+	return i.LTrimCtx(context.Background(), key, start, stop, datadogAdditionalInfo)
+}
 
-	tags := []string{fmt.Sprintf("type:%s", "ltrim")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
-	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
+// LTrimCtx is LTrim bounded by ctx
+func (i *RedisInstance) LTrimCtx(ctx context.Context, key string, start, stop int, datadogAdditionalInfo map[string]string) (err error) {
+	_, err = i.run(ctx, "ltrim", datadogAdditionalInfo, "LTRIM", key, start, stop)
 	return
 }
 func (i *RedisInstance) LRange(key string, startIndex int, endIndex int, datadogAdditionalInfo map[string]string) ([]string, error) {
-	loggingStartTime := time.Now()
-
-	rdsConn := i.RedisPool.Get()
-	results, err := redis.Strings(rdsConn.Do("LRANGE", key, startIndex, endIndex))
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		err = errRdsConn
-
-		return []string{}, err
-	}
+	return i.LRangeCtx(context.Background(), key, startIndex, endIndex, datadogAdditionalInfo)
+}
 
-	tags := []string{fmt.Sprintf("type:%s", "lrange")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
-	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
-	return results, err
+// LRangeCtx is LRange bounded by ctx
+func (i *RedisInstance) LRangeCtx(ctx context.Context, key string, startIndex int, endIndex int, datadogAdditionalInfo map[string]string) ([]string, error) {
+	return redis.Strings(i.run(ctx, "lrange", datadogAdditionalInfo, "LRANGE", key, startIndex, endIndex))
 }
 
 func (i *RedisInstance) Expire(key string, seconds int, datadogAdditionalInfo map[string]string) (result int, err error) {
-	loggingStartTime := time.Now()
-
-	rdsConn := i.RedisPool.Get()
-	_, err = rdsConn.Do("EXPIRE", key, seconds)
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		err = errRdsConn
-
-		return
-	}
+	return i.ExpireCtx(context.Background(), key, seconds, datadogAdditionalInfo)
+}
 
-	tags := []string{fmt.Sprintf("type:%s", "expire")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
-	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
-	return
+// ExpireCtx is Expire bounded by ctx
+func (i *RedisInstance) ExpireCtx(ctx context.Context, key string, seconds int, datadogAdditionalInfo map[string]string) (result int, err error) {
+	return redis.Int(i.run(ctx, "expire", datadogAdditionalInfo, "EXPIRE", key, seconds))
 }
 
 func (i *RedisInstance) Delete(key string, datadogAdditionalInfo map[string]string) (err error) {
-	loggingStartTime := time.Now()
-
-	rdsConn := i.RedisPool.Get()
-	_, err = rdsConn.Do("del", key)
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		err = errRdsConn
-
-		return
-	}
-
-	tags := []string{fmt.Sprintf("type:%s", "delete")}
-	for k, v := range datadogAdditionalInfo {
-		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
-	}
+	return i.DeleteCtx(context.Background(), key, datadogAdditionalInfo)
+}
 
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
+// DeleteCtx is Delete bounded by ctx
+func (i *RedisInstance) DeleteCtx(ctx context.Context, key string, datadogAdditionalInfo map[string]string) (err error) {
+	_, err = i.run(ctx, "delete", datadogAdditionalInfo, "del", key)
 	return
 }
 
 func (i *RedisInstance) Set(key string, value string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error) {
-	loggingStartTime := time.Now()
-	tags := []string{fmt.Sprintf("type:%s", "set")}
-	if expireSeconds <= 0 {
-		rdsConn := i.RedisPool.Get()
-		_, err = rdsConn.Do("set", key, value)
-		errRdsConn := rdsConn.Close()
-		if errRdsConn != nil {
-			err = errRdsConn
+	return i.SetCtx(context.Background(), key, value, expireSeconds, datadogAdditionalInfo)
+}
 
-			return
-		}
+// SetCtx is Set bounded by ctx
+func (i *RedisInstance) SetCtx(ctx context.Context, key string, value string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error) {
+	if expireSeconds <= 0 {
+		_, err = i.run(ctx, "set", datadogAdditionalInfo, "set", key, value)
 	} else {
-		rdsConn := i.RedisPool.Get()
-		_, err = rdsConn.Do("setex", key, expireSeconds, value)
-		errRdsConn := rdsConn.Close()
-		if errRdsConn != nil {
-			err = errRdsConn
-
-			return
-		}
+		_, err = i.run(ctx, "set", datadogAdditionalInfo, "setex", key, expireSeconds, value)
 	}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
-	i.datadog.RedisHistogram(
-		time.Since(loggingStartTime).Seconds()*1000,
-		tags,
-	)
 	return
 }
 
 func (i *RedisInstance) Get(key string, datadogAdditionalInfo map[string]string) (level string, err error) {
-	results := []byte{}
-	rdsConn := i.RedisPool.Get()
-	results, err = redis.Bytes(rdsConn.Do("get", key))
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		err = errRdsConn
-
-		return
-	}
+	return i.GetCtx(context.Background(), key, datadogAdditionalInfo)
+}
 
-	if err != nil {
-		if err.Error() == "redigo: nil returned" {
-			return "", nil
-		} else {
-			log.Printf("[Redis] Get [ %s ] failed: %s", datadogAdditionalInfo, err.Error())
-			return
-		}
+// GetCtx is Get bounded by ctx
+func (i *RedisInstance) GetCtx(ctx context.Context, key string, datadogAdditionalInfo map[string]string) (level string, err error) {
+	level, err = redis.String(i.run(ctx, "get", datadogAdditionalInfo, "get", key))
+	if err == redis.ErrNil {
+		return "", nil
 	}
-	level = string(results)
-
 	return
 }
 
-func (i *RedisInstance) Rename(key string, newkey string) (err error) {
-	rdsConn := i.RedisPool.Get()
-	_, err = rdsConn.Do("RENAME", key, newkey)
-	errRdsConn := rdsConn.Close()
-	if errRdsConn != nil {
-		err = errRdsConn
+func (i *RedisInstance) GetBytes(key string, datadogAdditionalInfo map[string]string) (value []byte, found bool, err error) {
+	return i.GetBytesCtx(context.Background(), key, datadogAdditionalInfo)
+}
 
-		return
+// GetBytesCtx return value of key, found is false when key does not exist. Unlike GetCtx an empty value is
+// told apart from a missing key
+func (i *RedisInstance) GetBytesCtx(ctx context.Context, key string, datadogAdditionalInfo map[string]string) (value []byte, found bool, err error) {
+	value, err = redis.Bytes(i.run(ctx, "get", datadogAdditionalInfo, "GET", key))
+	if err == redis.ErrNil {
+		return nil, false, nil
 	}
+	return value, err == nil, err
+}
 
-	tags := []string{fmt.Sprintf("type:%s", "rename")}
-	tags = append(tags, "ipredis:"+i.Config.Connection)
+func (i *RedisInstance) Rename(key string, newkey string) (err error) {
+	return i.RenameCtx(context.Background(), key, newkey)
+}
+
+// RenameCtx is Rename bounded by ctx
+func (i *RedisInstance) RenameCtx(ctx context.Context, key string, newkey string) (err error) {
+	_, err = i.run(ctx, "rename", nil, "RENAME", key, newkey)
 	return
 }
@@ -0,0 +1,222 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ErrRedisCircuitOpen is returned without contacting redis while the circuit breaker is open
+var ErrRedisCircuitOpen = errors.New("[error][redis] circuit breaker is open")
+
+// Circuit breaker states, exported as gauge circuit_state with the same value
+const (
+	BreakerClosed   = "closed"
+	BreakerHalfOpen = "half_open"
+	BreakerOpen     = "open"
+)
+
+var breakerStateValue = map[string]float64{
+	BreakerClosed:   0,
+	BreakerHalfOpen: 1,
+	BreakerOpen:     2,
+}
+
+// blockingCommands wait server side for data or replicas, their duration says nothing about redis health
+var blockingCommands = map[string]bool{
+	"BLPOP":      true,
+	"BRPOP":      true,
+	"BRPOPLPUSH": true,
+	"BLMOVE":     true,
+	"BLMPOP":     true,
+	"BZPOPMIN":   true,
+	"BZPOPMAX":   true,
+	"BZMPOP":     true,
+	"WAIT":       true,
+	"WAITAOF":    true,
+}
+
+// blocking tell whether cmd, or one command of a pipeline, may block server side. XREAD and XREADGROUP
+// block only with the BLOCK option
+func blocking(cmd *RedisCmd) bool {
+	for _, c := range cmd.Cmds {
+		if blocking(c) {
+			return true
+		}
+	}
+	name := strings.ToUpper(cmd.Name)
+	if blockingCommands[name] {
+		return true
+	}
+	if name == "XREAD" || name == "XREADGROUP" {
+		for _, arg := range cmd.Args {
+			if strings.EqualFold(argString(arg), "BLOCK") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// redisBreaker count calls of one instance and decide whether the next call may go through
+type redisBreaker struct {
+	cfg      BreakerConfig
+	instance *RedisInstance
+
+	mu          sync.Mutex
+	state       string
+	windowStart time.Time
+	openedAt    time.Time
+	requests    int
+	failures    int
+	probes      int
+	successes   int
+}
+
+func newRedisBreaker(instance *RedisInstance, cfg BreakerConfig) *redisBreaker {
+	if cfg.ErrorRate <= 0 {
+		// only SlowCall is set
+		cfg.ErrorRate = 0.5
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 20
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 10 * time.Second
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 5 * time.Second
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+	return &redisBreaker{
+		cfg:         cfg,
+		instance:    instance,
+		state:       BreakerClosed,
+		windowStart: time.Now(),
+	}
+}
+
+// BreakerState return circuit breaker state, BreakerClosed when the breaker is not enabled
+func (i *RedisInstance) BreakerState() string {
+	if i.breaker == nil {
+		return BreakerClosed
+	}
+	i.breaker.mu.Lock()
+	defer i.breaker.mu.Unlock()
+	return i.breaker.state
+}
+
+// hook reject calls while open and feed the outcome of every call back to the breaker
+func (b *redisBreaker) hook() RedisHook {
+	before := func(ctx context.Context, cmd *RedisCmd) (context.Context, error) {
+		return ctx, b.allow()
+	}
+	after := func(ctx context.Context, cmd *RedisCmd) {
+		if cmd.Err == ErrRedisCircuitOpen {
+			return
+		}
+		b.record(cmd.Err, time.Since(cmd.Start), blocking(cmd))
+	}
+	return RedisHook{
+		BeforeCommand:  before,
+		AfterCommand:   after,
+		BeforePipeline: before,
+		AfterPipeline:  after,
+	}
+}
+
+// allow return ErrRedisCircuitOpen when the call must not be sent
+func (b *redisBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	switch b.state {
+	case BreakerOpen:
+		if now.Sub(b.openedAt) < b.cfg.OpenTimeout {
+			return ErrRedisCircuitOpen
+		}
+		b.setState(BreakerHalfOpen)
+	case BreakerClosed:
+		if now.Sub(b.windowStart) >= b.cfg.Window {
+			b.windowStart, b.requests, b.failures = now, 0, 0
+		}
+	}
+
+	if b.state == BreakerHalfOpen {
+		if b.probes >= b.cfg.HalfOpenRequests {
+			return ErrRedisCircuitOpen
+		}
+		b.probes++
+	}
+	return nil
+}
+
+// failed tell whether a call outcome count against the instance. Redis error replies such as WRONGTYPE
+// and calls canceled by the caller say nothing about redis health, nor does the duration of a blocking call
+func (b *redisBreaker) failed(err error, elapsed time.Duration, blocking bool) bool {
+	if b.cfg.SlowCall > 0 && elapsed >= b.cfg.SlowCall && !blocking {
+		return true
+	}
+	if err == nil || err == ErrRedisCanceled {
+		return false
+	}
+	_, isReply := err.(redis.Error)
+	return !isReply
+}
+
+func (b *redisBreaker) record(err error, elapsed time.Duration, blocking bool) {
+	failed := b.failed(err, elapsed, blocking)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerHalfOpen:
+		if failed {
+			b.open()
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenRequests {
+			b.windowStart, b.requests, b.failures = time.Now(), 0, 0
+			b.setState(BreakerClosed)
+		}
+	case BreakerClosed:
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= b.cfg.MinRequests && float64(b.failures)/float64(b.requests) >= b.cfg.ErrorRate {
+			b.open()
+		}
+	}
+}
+
+func (b *redisBreaker) open() {
+	b.openedAt = time.Now()
+	b.setState(BreakerOpen)
+}
+
+// setState switch state, log the transition and export it. Caller must hold mu
+func (b *redisBreaker) setState(state string) {
+	if b.state == state {
+		return
+	}
+	log.Println("[warning][redis] circuit breaker", b.instance.Config.Connection, b.state, "->", state)
+	b.state = state
+	b.probes, b.successes = 0, 0
+
+	if b.instance.metrics != nil {
+		b.instance.metrics.SetGauge("redis", "circuit_state", breakerStateValue[state], []string{
+			"ipredis:" + b.instance.Config.Connection,
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package connection
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestBlocking(t *testing.T) {
+	tests := []struct {
+		cmd  *RedisCmd
+		want bool
+	}{
+		{&RedisCmd{Name: "GET", Args: []interface{}{"k"}}, false},
+		{&RedisCmd{Name: "blpop", Args: []interface{}{"k", 0}}, true},
+		{&RedisCmd{Name: "WAIT", Args: []interface{}{1, 100}}, true},
+		{&RedisCmd{Name: "XREAD", Args: []interface{}{"COUNT", 1, "STREAMS", "s", "0"}}, false},
+		{&RedisCmd{Name: "XREADGROUP", Args: []interface{}{"GROUP", "g", "c", "block", 100, "STREAMS", "s", ">"}}, true},
+		{&RedisCmd{pipeline: true, Cmds: []*RedisCmd{{Name: "GET"}, {Name: "BRPOP"}}}, true},
+		{&RedisCmd{pipeline: true, Cmds: []*RedisCmd{{Name: "GET"}, {Name: "SET"}}}, false},
+	}
+	for _, tc := range tests {
+		if got := blocking(tc.cmd); got != tc.want {
+			t.Errorf("blocking(%s %v %d cmds) = %v, want %v", tc.cmd.Name, tc.cmd.Args, len(tc.cmd.Cmds), got, tc.want)
+		}
+	}
+}
+
+func TestBreakerFailed(t *testing.T) {
+	b := newRedisBreaker(&RedisInstance{}, BreakerConfig{SlowCall: 100 * time.Millisecond})
+	tests := []struct {
+		name     string
+		err      error
+		elapsed  time.Duration
+		blocking bool
+		want     bool
+	}{
+		{"success", nil, time.Millisecond, false, false},
+		{"connection error", io.EOF, time.Millisecond, false, true},
+		{"error reply", redis.Error("WRONGTYPE"), time.Millisecond, false, false},
+		{"canceled by caller", ErrRedisCanceled, time.Millisecond, false, false},
+		{"slow", nil, time.Second, false, true},
+		{"slow blocking", nil, time.Second, true, false},
+	}
+	for _, tc := range tests {
+		if got := b.failed(tc.err, tc.elapsed, tc.blocking); got != tc.want {
+			t.Errorf("%s: failed %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestBreakerStateMachine(t *testing.T) {
+	b := newRedisBreaker(&RedisInstance{}, BreakerConfig{
+		ErrorRate:        0.5,
+		MinRequests:      4,
+		Window:           time.Hour,
+		OpenTimeout:      time.Hour,
+		HalfOpenRequests: 1,
+	})
+	// each step end the open timeout first when expire is set, then ask allow and, unless hold is set,
+	// record err when allowed
+	steps := []struct {
+		name      string
+		expire    bool
+		hold      bool
+		err       error
+		wantAllow error
+		wantState string
+	}{
+		{name: "success", wantState: BreakerClosed},
+		{name: "success", wantState: BreakerClosed},
+		{name: "failure below min requests", err: io.EOF, wantState: BreakerClosed},
+		{name: "failure reach error rate", err: io.EOF, wantState: BreakerOpen},
+		{name: "rejected while open", wantAllow: ErrRedisCircuitOpen, wantState: BreakerOpen},
+		{name: "probe after open timeout", expire: true, hold: true, wantState: BreakerHalfOpen},
+		{name: "one probe at a time", wantAllow: ErrRedisCircuitOpen, wantState: BreakerHalfOpen},
+	}
+	for idx, step := range steps {
+		if step.expire {
+			b.openedAt = b.openedAt.Add(-2 * b.cfg.OpenTimeout)
+		}
+		err := b.allow()
+		if err != step.wantAllow {
+			t.Fatalf("step %d %s: allow %v, want %v", idx, step.name, err, step.wantAllow)
+		}
+		if err == nil && !step.hold {
+			b.record(step.err, time.Millisecond, false)
+		}
+		if b.state != step.wantState {
+			t.Fatalf("step %d %s: state %s, want %s", idx, step.name, b.state, step.wantState)
+		}
+	}
+
+	// the held probe succeed and close the circuit with fresh counters
+	b.record(nil, time.Millisecond, false)
+	if b.state != BreakerClosed || b.requests != 0 {
+		t.Fatalf("after probe success: state %s with %d requests, want closed and reset", b.state, b.requests)
+	}
+
+	// a failed probe open the circuit again
+	for n := 0; n < 4; n++ {
+		b.allow()
+		b.record(io.EOF, time.Millisecond, false)
+	}
+	b.openedAt = b.openedAt.Add(-2 * b.cfg.OpenTimeout)
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe: allow %v", err)
+	}
+	b.record(io.EOF, time.Millisecond, false)
+	if b.state != BreakerOpen {
+		t.Fatalf("after probe failure: state %s, want open", b.state)
+	}
+}
@@ -0,0 +1,86 @@
+package connection
+
+import (
+	"context"
+)
+
+// RedisClient is the command set of RedisInstance, for code which should run against redistest.Fake in unit
+// tests. Features bound to a connection or to the instance itself, such as Pipeline, Watch, Scan, scripts,
+// locks, streams, Subscribe and the codec helpers, are only on RedisInstance
+type RedisClient interface {
+	HGetAll(key string, datadogAdditionalInfo map[string]string) (result map[string]string, err error)
+	HGetAllCtx(ctx context.Context, key string, datadogAdditionalInfo map[string]string) (result map[string]string, err error)
+	HLen(key string, datadogAdditionalInfo map[string]string) (result int, err error)
+	HLenCtx(ctx context.Context, key string, datadogAdditionalInfo map[string]string) (result int, err error)
+	HGet(key, field string, datadogAdditionalInfo map[string]string) (result string, err error)
+	HGetCtx(ctx context.Context, key, field string, datadogAdditionalInfo map[string]string) (result string, err error)
+	HSet(key, field string, value string, datadogAdditionalInfo map[string]string) (err error)
+	HSetCtx(ctx context.Context, key, field string, value string, datadogAdditionalInfo map[string]string) (err error)
+	HMGet(key string, fields []string, datadogAdditionalInfo map[string]string) (result map[string]string, err error)
+	HMGetCtx(ctx context.Context, key string, fields []string, datadogAdditionalInfo map[string]string) (result map[string]string, err error)
+	HMSet(key string, pairs map[string]string, datadogAdditionalInfo map[string]string) (err error)
+	HMSetCtx(ctx context.Context, key string, pairs map[string]string, datadogAdditionalInfo map[string]string) (err error)
+	HDel(key string, members []string, datadogAdditionalInfo map[string]string) (err error)
+	HDelCtx(ctx context.Context, key string, members []string, datadogAdditionalInfo map[string]string) (err error)
+
+	ZScore(key, member string, datadogAdditionalInfo map[string]string) (result float64, err error)
+	ZScoreCtx(ctx context.Context, key, member string, datadogAdditionalInfo map[string]string) (result float64, err error)
+	ZAdd(key string, pairs map[string]float64, datadogAdditionalInfo map[string]string) (result int, err error)
+	ZAddCtx(ctx context.Context, key string, pairs map[string]float64, datadogAdditionalInfo map[string]string) (result int, err error)
+	ZIncrBy(key string, increment float64, member string, datadogAdditionalInfo map[string]string) (err error)
+	ZIncrByCtx(ctx context.Context, key string, increment float64, member string, datadogAdditionalInfo map[string]string) (err error)
+	ZRevRangeByScore(key, max, min string, datadogAdditionalInfo map[string]string) (result []string, err error)
+	ZRevRangeByScoreCtx(ctx context.Context, key, max, min string, datadogAdditionalInfo map[string]string) (result []string, err error)
+	ZRevRange(key string, start, stop int, datadogAdditionalInfo map[string]string) (result []string, err error)
+	ZRevRangeCtx(ctx context.Context, key string, start, stop int, datadogAdditionalInfo map[string]string) (result []string, err error)
+	ZRevRangeWithscores(key string, start, stop int, datadogAdditionalInfo map[string]string) (result map[string]float64, err error)
+	ZRevRangeWithscoresCtx(ctx context.Context, key string, start, stop int, datadogAdditionalInfo map[string]string) (result map[string]float64, err error)
+	ZRange(key string, start, stop int, datadogAdditionalInfo map[string]string) (result []string, err error)
+	ZRangeCtx(ctx context.Context, key string, start, stop int, datadogAdditionalInfo map[string]string) (result []string, err error)
+	ZRangeWithscores(key string, start, stop int, datadogAdditionalInfo map[string]string) (result map[string]float64, err error)
+	ZRangeWithscoresCtx(ctx context.Context, key string, start, stop int, datadogAdditionalInfo map[string]string) (result map[string]float64, err error)
+	ZRangeByScore(key, min, max string, datadogAdditionalInfo map[string]string) (result []string, err error)
+	ZRangeByScoreCtx(ctx context.Context, key, min, max string, datadogAdditionalInfo map[string]string) (result []string, err error)
+	ZRem(key string, members []string, datadogAdditionalInfo map[string]string) (err error)
+	ZRemCtx(ctx context.Context, key string, members []string, datadogAdditionalInfo map[string]string) (err error)
+	ZCount(key, min, max string, datadogAdditionalInfo map[string]string) (result int, err error)
+	ZCountCtx(ctx context.Context, key, min, max string, datadogAdditionalInfo map[string]string) (result int, err error)
+
+	SAdd(key string, members []string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error)
+	SAddCtx(ctx context.Context, key string, members []string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error)
+	SMembers(key string, datadogAdditionalInfo map[string]string) ([]string, error)
+	SMembersCtx(ctx context.Context, key string, datadogAdditionalInfo map[string]string) ([]string, error)
+
+	RPush(key string, members []string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error)
+	RPushCtx(ctx context.Context, key string, members []string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error)
+	LPush(key string, members []string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error)
+	LPushCtx(ctx context.Context, key string, members []string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error)
+	LRem(key string, count int, value string, datadogAdditionalInfo map[string]string) (err error)
+	LRemCtx(ctx context.Context, key string, count int, value string, datadogAdditionalInfo map[string]string) (err error)
+	LTrim(key string, start, stop int, datadogAdditionalInfo map[string]string) (err error)
+	LTrimCtx(ctx context.Context, key string, start, stop int, datadogAdditionalInfo map[string]string) (err error)
+	LRange(key string, startIndex int, endIndex int, datadogAdditionalInfo map[string]string) ([]string, error)
+	LRangeCtx(ctx context.Context, key string, startIndex int, endIndex int, datadogAdditionalInfo map[string]string) ([]string, error)
+
+	IsExist(key string, datadogAdditionalInfo map[string]string) (bool, error)
+	IsExistCtx(ctx context.Context, key string, datadogAdditionalInfo map[string]string) (bool, error)
+	Expire(key string, seconds int, datadogAdditionalInfo map[string]string) (result int, err error)
+	ExpireCtx(ctx context.Context, key string, seconds int, datadogAdditionalInfo map[string]string) (result int, err error)
+	Delete(key string, datadogAdditionalInfo map[string]string) (err error)
+	DeleteCtx(ctx context.Context, key string, datadogAdditionalInfo map[string]string) (err error)
+	Set(key string, value string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error)
+	SetCtx(ctx context.Context, key string, value string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error)
+	Get(key string, datadogAdditionalInfo map[string]string) (level string, err error)
+	GetCtx(ctx context.Context, key string, datadogAdditionalInfo map[string]string) (level string, err error)
+	GetBytes(key string, datadogAdditionalInfo map[string]string) (value []byte, found bool, err error)
+	GetBytesCtx(ctx context.Context, key string, datadogAdditionalInfo map[string]string) (value []byte, found bool, err error)
+	Rename(key string, newkey string) (err error)
+	RenameCtx(ctx context.Context, key string, newkey string) (err error)
+
+	Publish(channel string, message string, datadogAdditionalInfo map[string]string) (receivers int, err error)
+	PublishCtx(ctx context.Context, channel string, message string, datadogAdditionalInfo map[string]string) (receivers int, err error)
+	Ping(ctx context.Context) (err error)
+	Close() error
+}
+
+var _ RedisClient = (*RedisInstance)(nil)
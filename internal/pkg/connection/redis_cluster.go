@@ -0,0 +1,524 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+const redisClusterSlots = 16384
+
+// ErrRedisCrossSlot is returned when keys of one command or one pipeline do not hash to the same cluster slot
+var ErrRedisCrossSlot = errors.New("[error][redis] CROSSSLOT keys in request don't hash to the same slot")
+
+type (
+	// redisCluster keep one pool per master node and the slot to node map
+	redisCluster struct {
+		cfg   RedisConfig
+		waits *poolWaits
+
+		mu    sync.RWMutex
+		pools map[string]*redis.Pool
+		slots []string
+
+		refreshing int32
+	}
+
+	// clusterConn is a redis.Conn bound lazily to the node owning the slot of the first keyed command
+	clusterConn struct {
+		cluster *redisCluster
+		ctx     context.Context
+
+		conn    redis.Conn
+		addr    string
+		slot    int
+		pending int
+		queued  []clusterCmd
+	}
+
+	clusterCmd struct {
+		name string
+		args []interface{}
+	}
+)
+
+var crc16Table [256]uint16
+
+func init() {
+	for i := range crc16Table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		crc16Table[i] = crc
+	}
+}
+
+// keySlot return cluster slot of key, honoring {hash tag}
+func keySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+
+	crc := uint16(0)
+	for i := 0; i < len(key); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^key[i]]
+	}
+	return int(crc) % redisClusterSlots
+}
+
+func argString(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// commandKeys return key arguments of cmd, nil for command without key
+func commandKeys(cmd string, args []interface{}) (keys []string) {
+	for _, idx := range keyIndexes(cmd, args) {
+		keys = append(keys, argString(args[idx]))
+	}
+	return
+}
+
+// keyIndexes return position of the key arguments of cmd in args
+func keyIndexes(cmd string, args []interface{}) (indexes []int) {
+	switch strings.ToUpper(cmd) {
+	case "", "MULTI", "EXEC", "DISCARD", "UNWATCH", "PING", "SCRIPT", "ASKING", "CLUSTER", "INFO", "PUBLISH", "SCAN":
+		return nil
+	case "EVAL", "EVALSHA":
+		if len(args) < 2 {
+			return nil
+		}
+		n, err := strconv.Atoi(argString(args[1]))
+		if err != nil {
+			return nil
+		}
+		for idx := 2; idx < 2+n && idx < len(args); idx++ {
+			indexes = append(indexes, idx)
+		}
+		return
+	case "DEL", "UNLINK", "EXISTS", "WATCH", "MGET", "SUNION", "SINTER", "SDIFF":
+		for idx := range args {
+			indexes = append(indexes, idx)
+		}
+		return
+	case "MSET", "MSETNX":
+		for idx := 0; idx < len(args); idx += 2 {
+			indexes = append(indexes, idx)
+		}
+		return
+	case "RENAME", "RENAMENX", "SMOVE", "RPOPLPUSH":
+		for idx := 0; idx < 2 && idx < len(args); idx++ {
+			indexes = append(indexes, idx)
+		}
+		return
+	case "XGROUP":
+		// XGROUP CREATE stream group ...
+		if len(args) > 1 {
+			indexes = append(indexes, 1)
+		}
+		return
+	case "XREAD", "XREADGROUP":
+		for idx, a := range args {
+			if strings.ToUpper(argString(a)) != "STREAMS" {
+				continue
+			}
+			streams := len(args) - idx - 1
+			for n := 0; n < streams/2; n++ {
+				indexes = append(indexes, idx+1+n)
+			}
+			return
+		}
+		return nil
+	}
+
+	if len(args) > 0 {
+		indexes = append(indexes, 0)
+	}
+	return
+}
+
+// commandSlot return slot shared by every key of cmd, -1 when cmd has no key
+func commandSlot(cmd string, args []interface{}) (int, error) {
+	keys := commandKeys(cmd, args)
+	if len(keys) <= 0 {
+		return -1, nil
+	}
+
+	slot := keySlot(keys[0])
+	for _, k := range keys[1:] {
+		if keySlot(k) != slot {
+			return -1, ErrRedisCrossSlot
+		}
+	}
+	return slot, nil
+}
+
+// parseRedirect read MOVED and ASK error into its slot and node address
+func parseRedirect(err error) (kind string, slot int, addr string) {
+	errReply, ok := err.(redis.Error)
+	if !ok {
+		return
+	}
+	fields := strings.Fields(string(errReply))
+	if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+		return
+	}
+	slot, errSlot := strconv.Atoi(fields[1])
+	if errSlot != nil {
+		return
+	}
+	return fields[0], slot, fields[2]
+}
+
+func newRedisCluster(cfg RedisConfig, waits *poolWaits) (c *redisCluster, err error) {
+	if cfg.ClusterMaxRedirects <= 0 {
+		cfg.ClusterMaxRedirects = 5
+	}
+
+	c = &redisCluster{
+		cfg:   cfg,
+		waits: waits,
+		pools: make(map[string]*redis.Pool),
+		slots: make([]string, redisClusterSlots),
+	}
+	err = c.refresh()
+	return
+}
+
+// pool return pool of node addr, creating it on first use
+func (c *redisCluster) pool(addr string) *redis.Pool {
+	c.mu.RLock()
+	p, ok := c.pools[addr]
+	c.mu.RUnlock()
+	if ok {
+		return p
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok = c.pools[addr]; ok {
+		return p
+	}
+	p, _ = newRedisPool(c.cfg, addr)
+	c.pools[addr] = p
+	return p
+}
+
+// refresh load slot map with CLUSTER SLOTS from the first reachable node
+func (c *redisCluster) refresh() (err error) {
+	addrs := append([]string{}, c.cfg.ClusterNodes...)
+	c.mu.RLock()
+	for addr := range c.pools {
+		addrs = append(addrs, addr)
+	}
+	c.mu.RUnlock()
+
+	for _, addr := range addrs {
+		rdsConn, errConn := getPooled(context.Background(), c.pool(addr), c.cfg.PoolWaitTimeout, c.waits)
+		if errConn != nil {
+			err = errConn
+			continue
+		}
+		reply, errSlots := redis.Values(rdsConn.Do("CLUSTER", "SLOTS"))
+		rdsConn.Close()
+		if errSlots != nil {
+			err = errSlots
+			continue
+		}
+
+		slots := make([]string, redisClusterSlots)
+		for _, r := range reply {
+			// each entry is [start, end, [host, port, id], replicas...]
+			entry, errEntry := redis.Values(r, nil)
+			if errEntry != nil || len(entry) < 3 {
+				continue
+			}
+			start, _ := redis.Int(entry[0], nil)
+			end, _ := redis.Int(entry[1], nil)
+			master, errMaster := redis.Values(entry[2], nil)
+			if errMaster != nil || len(master) < 2 {
+				continue
+			}
+			host, _ := redis.String(master[0], nil)
+			port, _ := redis.Int(master[1], nil)
+			if host == "" {
+				host, _, _ = net.SplitHostPort(addr)
+			}
+			node := net.JoinHostPort(host, strconv.Itoa(port))
+			for s := start; s <= end && s < redisClusterSlots; s++ {
+				slots[s] = node
+			}
+		}
+
+		c.mu.Lock()
+		c.slots = slots
+		c.mu.Unlock()
+		return nil
+	}
+
+	return fmt.Errorf("[error][redis] Failed to load cluster slots %s", err)
+}
+
+// refreshAsync reload slot map in background, at most one refresh runs at a time
+func (c *redisCluster) refreshAsync() {
+	if !atomic.CompareAndSwapInt32(&c.refreshing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&c.refreshing, 0)
+		if err := c.refresh(); err != nil {
+			log.Println("[warning]", err)
+		}
+	}()
+}
+
+func (c *redisCluster) nodeForSlot(slot int) string {
+	c.mu.RLock()
+	addr := c.slots[slot]
+	c.mu.RUnlock()
+	if addr == "" {
+		return c.cfg.ClusterNodes[0]
+	}
+	return addr
+}
+
+// masters return every distinct node owning slots
+func (c *redisCluster) masters() (nodes []string) {
+	seen := make(map[string]bool)
+	c.mu.RLock()
+	for _, addr := range c.slots {
+		if addr != "" && !seen[addr] {
+			seen[addr] = true
+			nodes = append(nodes, addr)
+		}
+	}
+	c.mu.RUnlock()
+	return
+}
+
+func (c *redisCluster) setSlot(slot int, addr string) {
+	c.mu.Lock()
+	c.slots[slot] = addr
+	c.mu.Unlock()
+}
+
+// Close close pool of every node
+func (c *redisCluster) Close() (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, p := range c.pools {
+		if errClose := p.Close(); errClose != nil {
+			err = errClose
+		}
+	}
+	return
+}
+
+func (c *redisCluster) conn(ctx context.Context) redis.Conn {
+	return &clusterConn{
+		cluster: c,
+		ctx:     ctx,
+		slot:    -1,
+	}
+}
+
+// bind attach cc to the node of cmd slot. Command without key sent before any keyed
+// command is queued, so MULTI goes to the same node as the keys following it
+func (cc *clusterConn) bind(cmd string, args []interface{}) (bound bool, err error) {
+	slot, err := commandSlot(cmd, args)
+	if err != nil {
+		return false, err
+	}
+	if cc.conn != nil {
+		if slot >= 0 {
+			if cc.slot >= 0 && cc.slot != slot {
+				return false, ErrRedisCrossSlot
+			}
+			cc.slot = slot
+		}
+		return true, nil
+	}
+	if slot < 0 {
+		return false, nil
+	}
+	return true, cc.connect(slot, cc.cluster.nodeForSlot(slot))
+}
+
+func (cc *clusterConn) connect(slot int, addr string) error {
+	rdsConn, err := getPooled(cc.ctx, cc.cluster.pool(addr), cc.cluster.cfg.PoolWaitTimeout, cc.cluster.waits)
+	if err != nil {
+		cc.cluster.refreshAsync()
+		return err
+	}
+	cc.conn = rdsConn
+	cc.addr = addr
+	cc.slot = slot
+
+	queued := cc.queued
+	cc.queued = nil
+	for _, q := range queued {
+		if err = cc.conn.Send(q.name, q.args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureConn bind to any node when only keyless commands were issued
+func (cc *clusterConn) ensureConn() error {
+	if cc.conn != nil {
+		return nil
+	}
+	return cc.connect(-1, cc.cluster.nodeForSlot(0))
+}
+
+// clusterSend run one command on a node connection
+type clusterSend func(c redis.Conn, cmd string, args ...interface{}) (interface{}, error)
+
+func doNode(c redis.Conn, cmd string, args ...interface{}) (interface{}, error) {
+	return c.Do(cmd, args...)
+}
+
+func (cc *clusterConn) do(send clusterSend, cmd string, args ...interface{}) (reply interface{}, err error) {
+	if _, err = cc.bind(cmd, args); err != nil {
+		return nil, err
+	}
+	if err = cc.ensureConn(); err != nil {
+		return nil, err
+	}
+
+	pipelined := cc.pending > 0 || cmd == ""
+	cc.pending = 0
+	reply, err = send(cc.conn, cmd, args...)
+
+	if pipelined {
+		// replies of a pipeline can not be replayed one by one, only learn the new topology
+		if values, ok := reply.([]interface{}); ok {
+			for _, v := range values {
+				if e, ok := v.(redis.Error); ok {
+					cc.learnRedirect(e)
+				}
+			}
+		}
+		cc.learnRedirect(err)
+		return
+	}
+
+	for redirects := 0; redirects < cc.cluster.cfg.ClusterMaxRedirects; redirects++ {
+		kind, slot, addr := parseRedirect(err)
+		switch kind {
+		case "MOVED":
+			cc.learnRedirect(err)
+			cc.conn.Close()
+			cc.conn = nil
+			if err = cc.connect(slot, addr); err != nil {
+				return nil, err
+			}
+			reply, err = send(cc.conn, cmd, args...)
+		case "ASK":
+			askConn, errAsk := getPooled(cc.ctx, cc.cluster.pool(addr), cc.cluster.cfg.PoolWaitTimeout, cc.cluster.waits)
+			if errAsk != nil {
+				return nil, errAsk
+			}
+			askConn.Send("ASKING")
+			reply, err = send(askConn, cmd, args...)
+			askConn.Close()
+		default:
+			return
+		}
+	}
+	return
+}
+
+// learnRedirect update slot map from MOVED error and schedule full refresh
+func (cc *clusterConn) learnRedirect(err error) {
+	kind, slot, addr := parseRedirect(err)
+	if kind != "MOVED" {
+		return
+	}
+	cc.cluster.setSlot(slot, addr)
+	cc.cluster.refreshAsync()
+}
+
+func (cc *clusterConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	return cc.do(doNode, cmd, args...)
+}
+
+func (cc *clusterConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	return cc.do(func(c redis.Conn, cmd string, args ...interface{}) (interface{}, error) {
+		return redis.DoWithTimeout(c, timeout, cmd, args...)
+	}, cmd, args...)
+}
+
+func (cc *clusterConn) Send(cmd string, args ...interface{}) error {
+	bound, err := cc.bind(cmd, args)
+	if err != nil {
+		return err
+	}
+	if !bound {
+		cc.queued = append(cc.queued, clusterCmd{name: cmd, args: args})
+		cc.pending++
+		return nil
+	}
+	cc.pending++
+	return cc.conn.Send(cmd, args...)
+}
+
+func (cc *clusterConn) Flush() error {
+	if err := cc.ensureConn(); err != nil {
+		return err
+	}
+	return cc.conn.Flush()
+}
+
+func (cc *clusterConn) Receive() (interface{}, error) {
+	if err := cc.ensureConn(); err != nil {
+		return nil, err
+	}
+	return cc.conn.Receive()
+}
+
+func (cc *clusterConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	if err := cc.ensureConn(); err != nil {
+		return nil, err
+	}
+	return redis.ReceiveWithTimeout(cc.conn, timeout)
+}
+
+func (cc *clusterConn) Err() error {
+	if cc.conn == nil {
+		return nil
+	}
+	return cc.conn.Err()
+}
+
+func (cc *clusterConn) Close() error {
+	if cc.conn == nil {
+		return nil
+	}
+	err := cc.conn.Close()
+	cc.conn = nil
+	return err
+}
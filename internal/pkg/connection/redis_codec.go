@@ -0,0 +1,283 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/json-iterator/go"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// ErrRedisNotProtoMessage is returned by ProtobufCodec for value not implementing proto.Message
+	ErrRedisNotProtoMessage = errors.New("[error][redis] protobuf codec need a proto.Message")
+	// ErrRedisNotStruct is returned by HMSetStruct and HGetAllStruct for value other than pointer to struct
+	ErrRedisNotStruct = errors.New("[error][redis] value must be a pointer to struct")
+)
+
+type (
+	// JSONCodec encode with jsoniter, compatible with encoding/json tags and output
+	JSONCodec struct{}
+	// MsgpackCodec encode with msgpack, smaller and faster than JSON for numeric heavy values
+	MsgpackCodec struct{}
+	// ProtobufCodec encode proto.Message values only
+	ProtobufCodec struct{}
+)
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(data, v)
+}
+
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (MsgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+func (ProtobufCodec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, ErrRedisNotProtoMessage
+	}
+	return proto.Marshal(msg)
+}
+
+func (ProtobufCodec) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return ErrRedisNotProtoMessage
+	}
+	return proto.Unmarshal(data, msg)
+}
+
+// SetCodec change codec of the typed helpers, nil restore JSONCodec
+func (i *RedisInstance) SetCodec(codec Codec) (err error) {
+	i.codec = codec
+	return
+}
+
+func (i *RedisInstance) getCodec() Codec {
+	if i.codec == nil {
+		return JSONCodec{}
+	}
+	return i.codec
+}
+
+// SetFrom encode v with the instance codec and store it in key, expireSeconds <= 0 keep it forever
+func (i *RedisInstance) SetFrom(key string, v interface{}, expireSeconds int, datadogAdditionalInfo map[string]string) (err error) {
+	return i.SetFromCtx(context.Background(), key, v, expireSeconds, datadogAdditionalInfo)
+}
+
+// SetFromCtx is SetFrom bounded by ctx
+func (i *RedisInstance) SetFromCtx(ctx context.Context, key string, v interface{}, expireSeconds int, datadogAdditionalInfo map[string]string) (err error) {
+	data, err := i.getCodec().Marshal(v)
+	if err != nil {
+		return fmt.Errorf("[error][redis] Failed to encode %s %s", key, err)
+	}
+	return i.SetCtx(ctx, key, string(data), expireSeconds, datadogAdditionalInfo)
+}
+
+// GetInto decode value of key into v, found is false when key does not exist
+func (i *RedisInstance) GetInto(key string, v interface{}, datadogAdditionalInfo map[string]string) (found bool, err error) {
+	return i.GetIntoCtx(context.Background(), key, v, datadogAdditionalInfo)
+}
+
+// GetIntoCtx is GetInto bounded by ctx
+func (i *RedisInstance) GetIntoCtx(ctx context.Context, key string, v interface{}, datadogAdditionalInfo map[string]string) (found bool, err error) {
+	data, err := redis.Bytes(i.run(ctx, "get", datadogAdditionalInfo, "GET", key))
+	return i.decode(key, data, err, v)
+}
+
+// HGetInto decode value of field in hash key into v, found is false when field does not exist
+func (i *RedisInstance) HGetInto(key, field string, v interface{}, datadogAdditionalInfo map[string]string) (found bool, err error) {
+	return i.HGetIntoCtx(context.Background(), key, field, v, datadogAdditionalInfo)
+}
+
+// HGetIntoCtx is HGetInto bounded by ctx
+func (i *RedisInstance) HGetIntoCtx(ctx context.Context, key, field string, v interface{}, datadogAdditionalInfo map[string]string) (found bool, err error) {
+	data, err := redis.Bytes(i.run(ctx, "hget", datadogAdditionalInfo, "HGET", key, field))
+	return i.decode(key, data, err, v)
+}
+
+func (i *RedisInstance) decode(key string, data []byte, errReply error, v interface{}) (found bool, err error) {
+	if errReply == redis.ErrNil {
+		return false, nil
+	}
+	if errReply != nil {
+		return false, errReply
+	}
+	if err = i.getCodec().Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("[error][redis] Failed to decode %s %s", key, err)
+	}
+	return true, nil
+}
+
+// HMSetStruct store every exported field of the struct pointed by v as one hash field. Field name is taken
+// from the `redis` tag, then the `json` tag, then the Go name, "-" skip the field. Strings, numbers, bools
+// and []byte are stored as is so they stay readable with HGet and HIncrBy, other fields go through the codec.
+// A nil pointer field is stored empty
+func (i *RedisInstance) HMSetStruct(key string, v interface{}, datadogAdditionalInfo map[string]string) (err error) {
+	return i.HMSetStructCtx(context.Background(), key, v, datadogAdditionalInfo)
+}
+
+// HMSetStructCtx is HMSetStruct bounded by ctx
+func (i *RedisInstance) HMSetStructCtx(ctx context.Context, key string, v interface{}, datadogAdditionalInfo map[string]string) (err error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return ErrRedisNotStruct
+	}
+	rv = rv.Elem()
+
+	pairs := make(map[string]string)
+	for idx, field := range structFields(rv.Type()) {
+		if field == "" {
+			continue
+		}
+		value, errEncode := i.encodeField(rv.Field(idx))
+		if errEncode != nil {
+			return fmt.Errorf("[error][redis] Failed to encode %s.%s %s", key, field, errEncode)
+		}
+		pairs[field] = value
+	}
+	return i.HMSetCtx(ctx, key, pairs, datadogAdditionalInfo)
+}
+
+// HGetAllStruct fill the struct pointed by v from hash key, the reverse of HMSetStruct. Hash fields without
+// struct field are ignored, found is false when key does not exist
+func (i *RedisInstance) HGetAllStruct(key string, v interface{}, datadogAdditionalInfo map[string]string) (found bool, err error) {
+	return i.HGetAllStructCtx(context.Background(), key, v, datadogAdditionalInfo)
+}
+
+// HGetAllStructCtx is HGetAllStruct bounded by ctx
+func (i *RedisInstance) HGetAllStructCtx(ctx context.Context, key string, v interface{}, datadogAdditionalInfo map[string]string) (found bool, err error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return false, ErrRedisNotStruct
+	}
+	rv = rv.Elem()
+
+	hash, err := i.HGetAllCtx(ctx, key, datadogAdditionalInfo)
+	if err != nil || len(hash) <= 0 {
+		return false, err
+	}
+
+	for idx, field := range structFields(rv.Type()) {
+		value, ok := hash[field]
+		if field == "" || !ok {
+			continue
+		}
+		if errDecode := i.decodeField(rv.Field(idx), value); errDecode != nil {
+			return false, fmt.Errorf("[error][redis] Failed to decode %s.%s %s", key, field, errDecode)
+		}
+	}
+	return true, nil
+}
+
+// structFields return hash field name of every struct field, empty for skipped field
+func structFields(t reflect.Type) []string {
+	fields := make([]string, t.NumField())
+	for idx := range fields {
+		f := t.Field(idx)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("redis"); ok {
+			name = strings.Split(tag, ",")[0]
+		} else if tag, ok := f.Tag.Lookup("json"); ok && strings.Split(tag, ",")[0] != "" {
+			name = strings.Split(tag, ",")[0]
+		}
+		if name == "-" {
+			continue
+		}
+		fields[idx] = name
+	}
+	return fields
+}
+
+func (i *RedisInstance) encodeField(fv reflect.Value) (string, error) {
+	switch fv.Kind() {
+	case reflect.String:
+		return fv.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(fv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(fv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(fv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(fv.Float(), 'f', -1, 64), nil
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(fv.Bytes()), nil
+		}
+	}
+
+	if fv.Kind() == reflect.Ptr {
+		// nil is stored empty, a pointer is handed to the codec as is so *pb.Msg stay a proto.Message
+		if fv.IsNil() {
+			return "", nil
+		}
+		data, err := i.getCodec().Marshal(fv.Interface())
+		return string(data), err
+	}
+	data, err := i.getCodec().Marshal(fv.Addr().Interface())
+	return string(data), err
+}
+
+func (i *RedisInstance) decodeField(fv reflect.Value, value string) (err error) {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+		return
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(value)
+		fv.SetBool(b)
+		return
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		n, err = strconv.ParseInt(value, 10, fv.Type().Bits())
+		fv.SetInt(n)
+		return
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		n, err = strconv.ParseUint(value, 10, fv.Type().Bits())
+		fv.SetUint(n)
+		return
+	case reflect.Float32, reflect.Float64:
+		var n float64
+		n, err = strconv.ParseFloat(value, fv.Type().Bits())
+		fv.SetFloat(n)
+		return
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.Uint8 {
+			fv.SetBytes([]byte(value))
+			return
+		}
+	}
+
+	if fv.Kind() == reflect.Ptr {
+		if value == "" {
+			fv.Set(reflect.Zero(fv.Type()))
+			return
+		}
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		return i.getCodec().Unmarshal([]byte(value), fv.Interface())
+	}
+	return i.getCodec().Unmarshal([]byte(value), fv.Addr().Interface())
+}
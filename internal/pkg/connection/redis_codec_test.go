@@ -0,0 +1,60 @@
+package connection
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestEncodeDecodeField(t *testing.T) {
+	type inner struct {
+		A int `json:"a"`
+	}
+	tests := []struct {
+		name    string
+		codec   Codec
+		value   interface{}
+		encoded string
+	}{
+		{"string", JSONCodec{}, "x", "x"},
+		{"int", JSONCodec{}, int64(-3), "-3"},
+		{"bytes", JSONCodec{}, []byte("raw"), "raw"},
+		{"struct", JSONCodec{}, inner{A: 1}, `{"a":1}`},
+		{"pointer", JSONCodec{}, &inner{A: 2}, `{"a":2}`},
+		{"nil pointer", JSONCodec{}, (*inner)(nil), ""},
+		{"proto pointer", ProtobufCodec{}, wrapperspb.String("p"), "\n\x01p"},
+		{"nil proto pointer", ProtobufCodec{}, (*wrapperspb.StringValue)(nil), ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			i := &RedisInstance{codec: tc.codec}
+			// fields of a struct are addressable, as in HMSetStruct
+			src := reflect.New(reflect.TypeOf(tc.value)).Elem()
+			src.Set(reflect.ValueOf(tc.value))
+
+			encoded, err := i.encodeField(src)
+			if err != nil {
+				t.Fatalf("encode: %s", err)
+			}
+			if encoded != tc.encoded {
+				t.Fatalf("encode: %q, want %q", encoded, tc.encoded)
+			}
+
+			dst := reflect.New(reflect.TypeOf(tc.value)).Elem()
+			if err = i.decodeField(dst, encoded); err != nil {
+				t.Fatalf("decode: %s", err)
+			}
+			if msg, ok := tc.value.(proto.Message); ok && !dst.IsNil() {
+				if !proto.Equal(msg, dst.Interface().(proto.Message)) {
+					t.Fatalf("decode: %v, want %v", dst.Interface(), tc.value)
+				}
+				return
+			}
+			if !reflect.DeepEqual(dst.Interface(), tc.value) {
+				t.Fatalf("decode: %#v, want %#v", dst.Interface(), tc.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package connection_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/loui58/odin/internal/pkg/connection"
+	"github.com/loui58/odin/internal/pkg/connection/redistest"
+)
+
+// TestRedisConformance run the redistest conformance suite against the redis at REDIS_ADDR, keys are kept
+// under a prefix unique to the run
+func TestRedisConformance(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR not set")
+	}
+	rds, err := connection.NewRedisWithMetrics(connection.RedisConfig{Connection: addr}, nil)
+	if err != nil {
+		t.Fatalf("connect %s: %s", addr, err)
+	}
+	defer rds.Close()
+
+	prefix := fmt.Sprintf("redistest:%d:", time.Now().UnixNano())
+	redistest.Conformance(t, func(t *testing.T) (connection.RedisClient, func(time.Duration)) {
+		return rds.WithPrefix(prefix), time.Sleep
+	})
+}
@@ -0,0 +1,82 @@
+package connection
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// redisTLSConfig build TLS config of cfg, files are read on every dial so renewed certificates are picked up
+func redisTLSConfig(cfg RedisConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.TLSServerName,
+		InsecureSkipVerify: cfg.TLSSkipVerify,
+	}
+	if cfg.TLSCAFile != "" {
+		ca, err := ioutil.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("[error][redis] Failed to read CA file %s", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("[error][redis] No certificate found in CA file %s", cfg.TLSCAFile)
+		}
+	}
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("[error][redis] Failed to load client certificate %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// redisCredentials return username and password of cfg, from CredentialsFile when it is set
+func redisCredentials(cfg RedisConfig) (username, password string, err error) {
+	if cfg.CredentialsFile == "" {
+		return cfg.Username, cfg.Password, nil
+	}
+	content, err := ioutil.ReadFile(cfg.CredentialsFile)
+	if err != nil {
+		return "", "", fmt.Errorf("[error][redis] Failed to read credentials file %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) >= 2 {
+		return strings.TrimSpace(lines[0]), strings.TrimSpace(lines[1]), nil
+	}
+	return cfg.Username, strings.TrimSpace(lines[0]), nil
+}
+
+// setupConn AUTH, SELECT and CLIENT SETNAME a new connection. redigo DialPassword and DialDatabase are not
+// used since they do not know ACL username
+func setupConn(c redis.Conn, cfg RedisConfig) error {
+	username, password, err := redisCredentials(cfg)
+	if err != nil {
+		return err
+	}
+	if password != "" {
+		args := []interface{}{password}
+		if username != "" {
+			args = []interface{}{username, password}
+		}
+		if _, err = c.Do("AUTH", args...); err != nil {
+			return fmt.Errorf("[error][redis] Failed to authenticate %s", err)
+		}
+	}
+	if cfg.DB != 0 && len(cfg.ClusterNodes) <= 0 {
+		if _, err = c.Do("SELECT", cfg.DB); err != nil {
+			return fmt.Errorf("[error][redis] Failed to select db %d %s", cfg.DB, err)
+		}
+	}
+	if cfg.ClientName != "" {
+		if _, err = c.Do("CLIENT", "SETNAME", cfg.ClientName); err != nil {
+			return fmt.Errorf("[error][redis] Failed to set client name %s", err)
+		}
+	}
+	return nil
+}
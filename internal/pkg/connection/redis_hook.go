@@ -0,0 +1,206 @@
+package connection
+
+import (
+	"context"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+type (
+	// RedisCmd is one command, or one pipeline or transaction, going through the hooks
+	RedisCmd struct {
+		// Type is the metric name of the call, such as hgetall or zrange_withscores
+		Type string
+		// Name and Args are what is sent to redis, Name is empty for pipeline and transaction
+		Name string
+		Args []interface{}
+		// Cmds are the commands of a pipeline or transaction. Commands of a transaction are known only
+		// after its TxFunc returned, BeforePipeline see them empty
+		Cmds []*RedisCmd
+		// Info is datadogAdditionalInfo of the call and Tags extra "key:value" pairs such as commands:3
+		Info map[string]string
+		Tags []string
+
+		Start time.Time
+		Reply interface{}
+		Err   error
+
+		pipeline bool
+	}
+
+	// RedisHook observe or alter commands, every field is optional. Before hooks run in registration
+	// order and may return a derived ctx, handed to the following hooks and to the After hooks. An error
+	// returned by a Before hook abort the call without sending it, it is then seen by OnError and After.
+	// After and OnError hooks run in reverse registration order, once Reply and Err are set
+	RedisHook struct {
+		BeforeCommand  func(ctx context.Context, cmd *RedisCmd) (context.Context, error)
+		AfterCommand   func(ctx context.Context, cmd *RedisCmd)
+		OnError        func(ctx context.Context, cmd *RedisCmd)
+		BeforePipeline func(ctx context.Context, cmd *RedisCmd) (context.Context, error)
+		AfterPipeline  func(ctx context.Context, cmd *RedisCmd)
+	}
+)
+
+// AddHook register hook for every following command. Hooks are meant to be added right after NewRedis,
+// before the instance is shared between goroutines
+func (i *RedisInstance) AddHook(hook RedisHook) {
+	i.hooks = append(i.hooks, hook)
+}
+
+// addBuiltinHooks register the breaker, metrics and tracing hooks, bound to i, ahead of any user hook
+func (i *RedisInstance) addBuiltinHooks() {
+	if i.breaker != nil {
+		i.AddHook(i.breaker.hook())
+	}
+	i.AddHook(i.metricsHook())
+	if i.Config.Tracing {
+		i.AddHook(i.tracingHook())
+	}
+	i.builtinHooks = len(i.hooks)
+}
+
+// metricsHook report latency of every command and pipeline to the instance metrics recorder
+func (i *RedisInstance) metricsHook() RedisHook {
+	after := func(ctx context.Context, cmd *RedisCmd) {
+		i.histogram(cmd.Type, cmd.Start, cmd.Info, cmd.Tags...)
+	}
+	return RedisHook{
+		AfterCommand:  after,
+		AfterPipeline: after,
+	}
+}
+
+// process run fn, the network part of cmd, wrapped by the hooks
+func (i *RedisInstance) process(ctx context.Context, cmd *RedisCmd, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	cmd.Start = time.Now()
+
+	for _, hook := range i.hooks {
+		before := hook.BeforeCommand
+		if cmd.pipeline {
+			before = hook.BeforePipeline
+		}
+		if before == nil {
+			continue
+		}
+		hookCtx, err := before(ctx, cmd)
+		if err != nil {
+			cmd.Err = err
+			break
+		}
+		if hookCtx != nil {
+			ctx = hookCtx
+		}
+	}
+
+	if cmd.Err == nil {
+		cmd.Reply, cmd.Err = fn(ctx)
+		i.near.written(cmd)
+	}
+
+	for idx := len(i.hooks) - 1; idx >= 0; idx-- {
+		hook := i.hooks[idx]
+		if cmd.Err != nil && hook.OnError != nil {
+			hook.OnError(ctx, cmd)
+		}
+		after := hook.AfterCommand
+		if cmd.pipeline {
+			after = hook.AfterPipeline
+		}
+		if after != nil {
+			after(ctx, cmd)
+		}
+	}
+	return cmd.Reply, cmd.Err
+}
+
+// run send one command on a pooled connection, retried according to Config.Retry. Read-only commands are
+// answered by the near cache when it hold the reply, else go to a replica when there are some, or to the
+// primary when every replica is failing or the chosen one could not be reached
+func (i *RedisInstance) run(ctx context.Context, cmdType string, datadogAdditionalInfo map[string]string, name string, args ...interface{}) (interface{}, error) {
+	args = i.prefixArgs(name, args)
+	entry, cached, hit := i.near.lookup(ctx, name, args)
+	if hit {
+		return cached, nil
+	}
+
+	cmd := &RedisCmd{Type: cmdType, Name: name, Args: args, Info: datadogAdditionalInfo}
+	defer func() {
+		i.near.fill(entry, cmd.Reply, cmd.Err)
+	}()
+	return i.processRetry(ctx, cmd, func(ctx context.Context) (reply interface{}, err error) {
+		if replica := i.replicaFor(ctx, name); replica != nil {
+			if reply, served, err := replica.read(ctx, i, name, args...); served {
+				return reply, err
+			}
+		}
+
+		rdsConn, errConn := i.getConn(ctx)
+		if errConn != nil {
+			err = errConn
+
+			return
+		}
+		reply, err = doCtx(ctx, rdsConn, name, args...)
+		errRdsConn := rdsConn.Close()
+		if errRdsConn != nil {
+			err = errRdsConn
+
+			return
+		}
+		return
+	})
+}
+
+// runOn send one command on rdsConn, for commands bound to a connection such as transaction reads.
+// It is never retried, a broken connection stays broken
+func (i *RedisInstance) runOn(ctx context.Context, rdsConn redis.Conn, cmdType string, datadogAdditionalInfo map[string]string, name string, args ...interface{}) (interface{}, error) {
+	args = i.prefixArgs(name, args)
+	cmd := &RedisCmd{Type: cmdType, Name: name, Args: args, Info: datadogAdditionalInfo}
+	return i.process(ctx, cmd, func(ctx context.Context) (interface{}, error) {
+		return doCtx(ctx, rdsConn, name, args...)
+	})
+}
+
+// runMulti send cmds inside MULTI/EXEC on a pooled connection, through the pipeline hooks
+func (i *RedisInstance) runMulti(ctx context.Context, cmdType string, datadogAdditionalInfo map[string]string, cmds []pipelined) (err error) {
+	i.prefixCmds(cmds)
+	cmd := &RedisCmd{Type: cmdType, Cmds: hookCmds(cmds), Info: datadogAdditionalInfo, pipeline: true}
+	_, err = i.processRetry(ctx, cmd, func(ctx context.Context) (reply interface{}, err error) {
+		resetPipelined(cmds)
+		rdsConn, errConn := i.getConn(ctx)
+		if errConn != nil {
+			err = errConn
+
+			return
+		}
+		err = multiExec(ctx, rdsConn, cmds)
+		setHookReplies(cmd.Cmds, cmds)
+		errRdsConn := rdsConn.Close()
+		if errRdsConn != nil {
+			err = errRdsConn
+
+			return
+		}
+		return
+	})
+	return
+}
+
+// hookCmds describe queued pipeline commands for the hooks
+func hookCmds(cmds []pipelined) []*RedisCmd {
+	hooked := make([]*RedisCmd, len(cmds))
+	for idx, cmd := range cmds {
+		c := cmd.command()
+		hooked[idx] = &RedisCmd{Name: c.name, Args: c.args}
+	}
+	return hooked
+}
+
+// setHookReplies copy results of executed pipeline commands to their hook description
+func setHookReplies(hooked []*RedisCmd, cmds []pipelined) {
+	for idx, cmd := range cmds {
+		c := cmd.command()
+		hooked[idx].Reply, hooked[idx].Err = c.reply, c.err
+	}
+}
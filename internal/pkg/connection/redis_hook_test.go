@@ -0,0 +1,158 @@
+package connection
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// serveRESP start a redis stand-in on a local port answering every command with reply, it stop with the test
+func serveRESP(t *testing.T, reply func(args []string) string) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				r := bufio.NewReader(c)
+				for {
+					args, err := readCommand(r)
+					if err != nil {
+						return
+					}
+					if _, err = c.Write([]byte(reply(args))); err != nil {
+						return
+					}
+				}
+			}(c)
+		}
+	}()
+	return l.Addr().String()
+}
+
+// readCommand read one RESP array of bulk strings
+func readCommand(r *bufio.Reader) (args []string, err error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	for idx := 0; idx < n; idx++ {
+		if _, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, strings.TrimSuffix(arg, "\r\n"))
+	}
+	return args, nil
+}
+
+func TestHookSeeCommand(t *testing.T) {
+	addr := serveRESP(t, func(args []string) string { return "+OK\r\n" })
+	rds, err := NewRedisWithMetrics(RedisConfig{Connection: addr}, nil)
+	if err != nil {
+		t.Fatalf("redis: %s", err)
+	}
+	defer rds.Close()
+
+	var seen *RedisCmd
+	rds.AddHook(RedisHook{AfterCommand: func(ctx context.Context, cmd *RedisCmd) { seen = cmd }})
+
+	info := map[string]string{"caller": "test"}
+	tests := []struct {
+		name string
+		call func() error
+		cmd  string
+		args []interface{}
+	}{
+		{"set", func() error { return rds.Set("k", "v", 0, info) }, "set", []interface{}{"k", "v"}},
+		{"setex", func() error { return rds.Set("k", "v", 10, info) }, "setex", []interface{}{"k", 10, "v"}},
+		{"get", func() error { _, err := rds.Get("k", info); return err }, "get", []interface{}{"k"}},
+		{"delete", func() error { return rds.Delete("k", info) }, "del", []interface{}{"k"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			seen = nil
+			if err := tc.call(); err != nil {
+				t.Fatalf("call: %s", err)
+			}
+			if seen == nil {
+				t.Fatal("hook not called")
+			}
+			if seen.Name != tc.cmd || !reflect.DeepEqual(seen.Args, tc.args) {
+				t.Fatalf("hook saw %s %v, want %s %v", seen.Name, seen.Args, tc.cmd, tc.args)
+			}
+			if !reflect.DeepEqual(seen.Info, info) {
+				t.Fatalf("hook saw info %v, want %v", seen.Info, info)
+			}
+		})
+	}
+}
+
+func TestHookOrder(t *testing.T) {
+	addr := serveRESP(t, func(args []string) string { return "+OK\r\n" })
+	errStop := errors.New("stop")
+	tests := []struct {
+		name   string
+		stopAt int
+		want   string
+		err    error
+	}{
+		{name: "before in order, after in reverse", stopAt: -1, want: "b0 b1 b2 a2 a1 a0"},
+		{name: "before error skip the command", stopAt: 1, want: "b0 b1 e2 a2 e1 a1 e0 a0", err: errStop},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rds, err := NewRedisWithMetrics(RedisConfig{Connection: addr}, nil)
+			if err != nil {
+				t.Fatalf("redis: %s", err)
+			}
+			defer rds.Close()
+
+			var calls []string
+			for idx := 0; idx < 3; idx++ {
+				idx := idx
+				rds.AddHook(RedisHook{
+					BeforeCommand: func(ctx context.Context, cmd *RedisCmd) (context.Context, error) {
+						calls = append(calls, "b"+strconv.Itoa(idx))
+						if idx == tc.stopAt {
+							return ctx, errStop
+						}
+						return ctx, nil
+					},
+					AfterCommand: func(ctx context.Context, cmd *RedisCmd) {
+						calls = append(calls, "a"+strconv.Itoa(idx))
+					},
+					OnError: func(ctx context.Context, cmd *RedisCmd) {
+						calls = append(calls, "e"+strconv.Itoa(idx))
+					},
+				})
+			}
+			if err = rds.Set("k", "v", 0, nil); err != tc.err {
+				t.Fatalf("set: err %v, want %v", err, tc.err)
+			}
+			if got := strings.Join(calls, " "); got != tc.want {
+				t.Fatalf("hooks ran %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package connection
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"math"
+	mathrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+var (
+	// compare and delete and compare and extend, only the token owner may touch the key
+	lockReleaseScript = newLuaScript("lock_release", `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`)
+	lockRenewScript   = newLuaScript("lock_renew", `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) else return 0 end`)
+)
+
+var (
+	// ErrRedisLockNotAcquired is returned when the lock is held by another owner
+	ErrRedisLockNotAcquired = errors.New("[error][redis] lock is held by another owner")
+	// ErrRedisLockNotHeld is returned by Unlock and Renew when the lease expired or was taken over
+	ErrRedisLockNotHeld = errors.New("[error][redis] lock is not held anymore")
+)
+
+type (
+	// LockOptions configure lease and retry of a lock. Zero value use the defaults
+	LockOptions struct {
+		// TTL is lease duration, default 30 second
+		TTL time.Duration
+		// RenewInterval is how often the lease is extended while held, default TTL/3. Negative disable renewal
+		RenewInterval time.Duration
+		// RetryMin and RetryMax bound the exponential backoff of blocking Lock, default 50ms and 1s
+		RetryMin time.Duration
+		RetryMax time.Duration
+
+		DatadogAdditionalInfo map[string]string
+	}
+
+	// Redlock take locks on a majority of independent redis instances
+	Redlock struct {
+		instances []*RedisInstance
+	}
+
+	// Lock is a held lease. Lost is closed when renewal fail and the lease can not be trusted anymore
+	Lock struct {
+		locker *Redlock
+		key    string
+		token  string
+		opt    LockOptions
+
+		mu       sync.Mutex
+		released bool
+		stop     chan struct{}
+		done     chan struct{}
+		lost     chan struct{}
+	}
+)
+
+// NewRedlock create locker over independent instances, each usually from its own RedisConfig
+func NewRedlock(instances ...*RedisInstance) *Redlock {
+	return &Redlock{
+		instances: instances,
+	}
+}
+
+// TryLock take lock on key once, returning ErrRedisLockNotAcquired when someone else hold it
+func (i *RedisInstance) TryLock(ctx context.Context, key string, opt LockOptions) (*Lock, error) {
+	return NewRedlock(i).TryLock(ctx, key, opt)
+}
+
+// Lock wait until lock on key is taken or ctx is done
+func (i *RedisInstance) Lock(ctx context.Context, key string, opt LockOptions) (*Lock, error) {
+	return NewRedlock(i).Lock(ctx, key, opt)
+}
+
+func (opt LockOptions) withDefaults() LockOptions {
+	if opt.TTL <= 0 {
+		opt.TTL = 30 * time.Second
+	}
+	if opt.RenewInterval == 0 {
+		opt.RenewInterval = opt.TTL / 3
+	}
+	if opt.RetryMin <= 0 {
+		opt.RetryMin = 50 * time.Millisecond
+	}
+	if opt.RetryMax <= 0 {
+		opt.RetryMax = time.Second
+	}
+	return opt
+}
+
+func (r *Redlock) quorum() int {
+	return len(r.instances)/2 + 1
+}
+
+// TryLock SET NX PX a random token on every instance, and keep the lock when a majority
+// accepted it before the lease ran out. Partial acquisition is rolled back
+func (r *Redlock) TryLock(ctx context.Context, key string, opt LockOptions) (*Lock, error) {
+	opt = opt.withDefaults()
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	l := &Lock{
+		locker: r,
+		key:    key,
+		token:  hex.EncodeToString(b),
+		opt:    opt,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		lost:   make(chan struct{}),
+	}
+
+	start := time.Now()
+	acquired := 0
+	var lastErr error
+	for _, i := range r.instances {
+		ok, err := i.setNX(ctx, key, l.token, opt)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if ok {
+			acquired++
+		}
+	}
+
+	// clock drift allowance of the redlock algorithm
+	drift := time.Duration(float64(opt.TTL)*0.01) + 2*time.Millisecond
+	validity := opt.TTL - time.Since(start) - drift
+	if acquired < r.quorum() || validity <= 0 {
+		l.release(context.Background())
+		if ctxErr := ctxErr(ctx); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if acquired == 0 && lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, ErrRedisLockNotAcquired
+	}
+
+	if opt.RenewInterval > 0 {
+		go l.renewLoop()
+	} else {
+		close(l.done)
+	}
+	return l, nil
+}
+
+// Lock retry TryLock with jittered exponential backoff until it succeed or ctx is done
+func (r *Redlock) Lock(ctx context.Context, key string, opt LockOptions) (*Lock, error) {
+	opt = opt.withDefaults()
+
+	for attempt := 0; ; attempt++ {
+		l, err := r.TryLock(ctx, key, opt)
+		if err != ErrRedisLockNotAcquired {
+			return l, err
+		}
+
+		backoff := time.Duration(float64(opt.RetryMin) * math.Pow(2, float64(attempt)))
+		if backoff > opt.RetryMax || backoff <= 0 {
+			backoff = opt.RetryMax
+		}
+		backoff = backoff/2 + time.Duration(mathrand.Int63n(int64(backoff/2)+1))
+
+		select {
+		case <-ctx.Done():
+			return nil, ctxErr(ctx)
+		case <-time.After(backoff):
+		}
+	}
+}
+
+func (i *RedisInstance) setNX(ctx context.Context, key, token string, opt LockOptions) (ok bool, err error) {
+	_, err = redis.String(i.run(ctx, "lock", opt.DatadogAdditionalInfo, "SET", key, token, "NX", "PX", int64(opt.TTL/time.Millisecond)))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Key return locked key
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Lost is closed when the lease could not be renewed on a majority of instances
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Renew extend the lease to a full TTL, ErrRedisLockNotHeld when the majority does not hold the token anymore
+func (l *Lock) Renew(ctx context.Context) error {
+	renewed := 0
+	for _, i := range l.locker.instances {
+		n, err := i.evalScript(ctx, lockRenewScript, []string{l.key}, []interface{}{l.token, int64(l.opt.TTL / time.Millisecond)}, l.opt.DatadogAdditionalInfo).Int()
+		if err == nil && n > 0 {
+			renewed++
+		}
+	}
+	if renewed < l.locker.quorum() {
+		return ErrRedisLockNotHeld
+	}
+	return nil
+}
+
+func (l *Lock) renewLoop() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.opt.RenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), l.opt.RenewInterval)
+		err := l.Renew(ctx)
+		cancel()
+		if err != nil {
+			log.Println("[warning][redis] lock", l.key, "lost:", err)
+			close(l.lost)
+			return
+		}
+	}
+}
+
+// Unlock stop renewal and delete the key on every instance where it still hold our token
+func (l *Lock) Unlock(ctx context.Context) error {
+	l.mu.Lock()
+	if l.released {
+		l.mu.Unlock()
+		return ErrRedisLockNotHeld
+	}
+	l.released = true
+	close(l.stop)
+	l.mu.Unlock()
+	<-l.done
+
+	if l.release(ctx) < l.locker.quorum() {
+		return ErrRedisLockNotHeld
+	}
+	return nil
+}
+
+// release compare and delete on every instance, return how many instances still held the lock
+func (l *Lock) release(ctx context.Context) (released int) {
+	for _, i := range l.locker.instances {
+		n, err := i.evalScript(ctx, lockReleaseScript, []string{l.key}, []interface{}{l.token}, l.opt.DatadogAdditionalInfo).Int()
+		if err == nil && n > 0 {
+			released++
+		}
+	}
+	return
+}
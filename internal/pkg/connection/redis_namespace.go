@@ -0,0 +1,67 @@
+package connection
+
+import (
+	"strings"
+)
+
+// WithPrefix return an instance sharing pools, breaker, metrics recorder and scripts of i whose keys are
+// prefixed by prefix, after the namespace of i. The metrics and tracing hooks are rebuilt for the new
+// instance, so they report its namespace, and hooks added with AddHook are copied. Hooks added later to one
+// instance are not seen by the other
+func (i *RedisInstance) WithPrefix(prefix string) *RedisInstance {
+	cfg := i.Config
+	cfg.Namespace += prefix
+	if i.scripts == nil {
+		i.scripts = &redisScripts{}
+	}
+	derived := &RedisInstance{
+		RedisPool: i.RedisPool,
+		Config:    cfg,
+		metrics:   i.metrics,
+		breaker:   i.breaker,
+		replicas:  i.replicas,
+		near:      i.near,
+		cluster:   i.cluster,
+		sentinel:  i.sentinel,
+		codec:     i.codec,
+		scripts:   i.scripts,
+		waits:     i.waits,
+		stop:      i.stop,
+		shared:    true,
+	}
+	derived.addBuiltinHooks()
+	derived.hooks = append(derived.hooks, i.hooks[i.builtinHooks:]...)
+	return derived
+}
+
+// prefixArgs return args with the namespace prepended to every key argument of cmd
+func (i *RedisInstance) prefixArgs(cmd string, args []interface{}) []interface{} {
+	if i.Config.Namespace == "" {
+		return args
+	}
+	indexes := keyIndexes(cmd, args)
+	if len(indexes) <= 0 {
+		return args
+	}
+	prefixed := append([]interface{}{}, args...)
+	for _, idx := range indexes {
+		prefixed[idx] = i.Config.Namespace + argString(args[idx])
+	}
+	return prefixed
+}
+
+// prefixCmds prepend the namespace to keys of queued pipeline commands
+func (i *RedisInstance) prefixCmds(cmds []pipelined) {
+	if i.Config.Namespace == "" {
+		return
+	}
+	for _, cmd := range cmds {
+		c := cmd.command()
+		c.args = i.prefixArgs(c.name, c.args)
+	}
+}
+
+// unprefixKey remove the namespace of a key returned by redis
+func (i *RedisInstance) unprefixKey(key string) string {
+	return strings.TrimPrefix(key, i.Config.Namespace)
+}
@@ -0,0 +1,115 @@
+package connection
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestKeyIndexes(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		args []interface{}
+		want []int
+	}{
+		{"GET", []interface{}{"k"}, []int{0}},
+		{"hset", []interface{}{"k", "f", "v"}, []int{0}},
+		{"PING", nil, nil},
+		{"SCAN", []interface{}{"0", "MATCH", "*"}, nil},
+		{"PUBLISH", []interface{}{"channel", "message"}, nil},
+		{"DEL", []interface{}{"a", "b", "c"}, []int{0, 1, 2}},
+		{"MSET", []interface{}{"a", 1, "b", 2}, []int{0, 2}},
+		{"RENAME", []interface{}{"a", "b"}, []int{0, 1}},
+		{"EVAL", []interface{}{"return 1", 2, "a", "b", "arg"}, []int{2, 3}},
+		{"EVALSHA", []interface{}{"sha", "0", "arg"}, nil},
+		{"EVALSHA", []interface{}{"sha", "x"}, nil},
+		{"XGROUP", []interface{}{"CREATE", "s", "g", "$"}, []int{1}},
+		{"XREAD", []interface{}{"COUNT", 1, "STREAMS", "a", "b", "0", "0"}, []int{3, 4}},
+		{"XREADGROUP", []interface{}{"GROUP", "g", "c", "BLOCK", 10, "streams", "s", ">"}, []int{6}},
+		{"XREADGROUP", []interface{}{"GROUP", "g", "c"}, nil},
+	}
+	for _, tc := range tests {
+		if got := keyIndexes(tc.cmd, tc.args); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("keyIndexes(%s %v) = %v, want %v", tc.cmd, tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestPrefixArgs(t *testing.T) {
+	i := &RedisInstance{Config: RedisConfig{Namespace: "ns:"}}
+	tests := []struct {
+		cmd  string
+		args []interface{}
+		want []interface{}
+	}{
+		{"GET", []interface{}{"k"}, []interface{}{"ns:k"}},
+		{"MSET", []interface{}{"a", 1, "b", 2}, []interface{}{"ns:a", 1, "ns:b", 2}},
+		{"EVALSHA", []interface{}{"sha", 1, "k", "arg"}, []interface{}{"sha", 1, "ns:k", "arg"}},
+		{"XREADGROUP", []interface{}{"GROUP", "g", "c", "STREAMS", "s", ">"}, []interface{}{"GROUP", "g", "c", "STREAMS", "ns:s", ">"}},
+		{"PING", []interface{}{}, []interface{}{}},
+	}
+	for _, tc := range tests {
+		args := append([]interface{}{}, tc.args...)
+		got := i.prefixArgs(tc.cmd, args)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("prefixArgs(%s %v) = %v, want %v", tc.cmd, tc.args, got, tc.want)
+		}
+		if !reflect.DeepEqual(args, tc.args) {
+			t.Errorf("prefixArgs(%s) changed the caller args to %v", tc.cmd, args)
+		}
+	}
+}
+
+// tagRecorder keep the tags of every latency observation
+type tagRecorder struct {
+	NoopMetrics
+	tags [][]string
+}
+
+func (r *tagRecorder) ObserveLatency(backend, command string, elapsed time.Duration, tags []string) {
+	r.tags = append(r.tags, tags)
+}
+
+func TestWithPrefixHooks(t *testing.T) {
+	addr := serveRESP(t, func(args []string) string { return "+OK\r\n" })
+	recorder := &tagRecorder{}
+	rds, err := NewRedisWithMetrics(RedisConfig{Connection: addr, Namespace: "app:"}, recorder)
+	if err != nil {
+		t.Fatalf("redis: %s", err)
+	}
+	defer rds.Close()
+	var userHook int
+	rds.AddHook(RedisHook{AfterCommand: func(ctx context.Context, cmd *RedisCmd) { userHook++ }})
+	derived := rds.WithPrefix("tenant:")
+
+	tests := []struct {
+		name      string
+		instance  *RedisInstance
+		namespace string
+	}{
+		{"parent", rds, "namespace:app:"},
+		{"derived", derived, "namespace:app:tenant:"},
+	}
+	for _, tc := range tests {
+		recorder.tags, userHook = nil, 0
+		if err = tc.instance.Set("k", "v", 0, nil); err != nil {
+			t.Fatalf("%s: set %s", tc.name, err)
+		}
+		if len(recorder.tags) != 1 || !contains(recorder.tags[0], tc.namespace) {
+			t.Errorf("%s: metrics tags %v, want one observation tagged %s", tc.name, recorder.tags, tc.namespace)
+		}
+		if userHook != 1 {
+			t.Errorf("%s: user hook ran %d times, want 1", tc.name, userHook)
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
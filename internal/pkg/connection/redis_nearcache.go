@@ -0,0 +1,467 @@
+package connection
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Invalidation source of NearCacheConfig.Invalidation
+const (
+	NearCacheTracking = "tracking"
+	NearCacheKeyspace = "keyspace"
+)
+
+const (
+	nearCachePing = 30 * time.Second
+	// nearCacheEntryOverhead is the estimated size of an entry besides its key and reply
+	nearCacheEntryOverhead = 96
+)
+
+var errNearCacheClosed = errors.New("[error][redis] near cache closed")
+
+type (
+	// nearCache is an LRU of read replies, emptied by invalidation messages of a dedicated connection
+	nearCache struct {
+		cfg      RedisConfig
+		instance *RedisInstance
+		dial     func() (redis.Conn, error)
+
+		// ready is 1 while the invalidation connection is subscribed, entries are only served then
+		ready int32
+
+		hits      int64
+		misses    int64
+		evictions int64
+
+		mu      sync.Mutex
+		bytes   int64
+		lru     *list.List
+		entries map[string]*list.Element
+		// byKey index entries of every redis key, one key has an entry per command reading it
+		byKey  map[string]map[string]*list.Element
+		conn   redis.Conn
+		closed bool
+		stop   chan struct{}
+	}
+
+	// nearEntry is one cached reply. It is inserted empty before the read is sent, an invalidation arriving
+	// meanwhile remove it so the possibly stale reply is never stored
+	nearEntry struct {
+		id      string
+		key     string
+		reply   interface{}
+		filled  bool
+		size    int64
+		expires time.Time
+	}
+
+	// NearCacheStats count near cache activity since NewRedis
+	NearCacheStats struct {
+		Hits      int64
+		Misses    int64
+		Evictions int64
+		Entries   int
+		Bytes     int64
+	}
+)
+
+func newNearCache(instance *RedisInstance, dial func() (redis.Conn, error)) *nearCache {
+	cfg := instance.Config
+	if cfg.NearCache.MaxBytes <= 0 {
+		cfg.NearCache.MaxBytes = 64 << 20
+	}
+	if cfg.NearCache.MaxTTL <= 0 {
+		cfg.NearCache.MaxTTL = time.Minute
+	}
+	if cfg.NearCache.MinTTL <= 0 || cfg.NearCache.MinTTL > cfg.NearCache.MaxTTL {
+		cfg.NearCache.MinTTL = cfg.NearCache.MaxTTL / 2
+	}
+	return &nearCache{
+		cfg:      cfg,
+		instance: instance,
+		dial:     dial,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		byKey:    make(map[string]map[string]*list.Element),
+		stop:     make(chan struct{}),
+	}
+}
+
+// NearCacheStats return counters of the near cache, zero when it is not enabled
+func (i *RedisInstance) NearCacheStats() NearCacheStats {
+	n := i.near
+	if n == nil {
+		return NearCacheStats{}
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return NearCacheStats{
+		Hits:      atomic.LoadInt64(&n.hits),
+		Misses:    atomic.LoadInt64(&n.misses),
+		Evictions: atomic.LoadInt64(&n.evictions),
+		Entries:   len(n.entries),
+		Bytes:     n.bytes,
+	}
+}
+
+// cacheable return the key read by name when its reply can be cached
+func (n *nearCache) cacheable(name string, args []interface{}) (key string, ok bool) {
+	if !readOnlyCommands[strings.ToUpper(name)] {
+		return "", false
+	}
+	keys := commandKeys(name, args)
+	if len(keys) != 1 {
+		return "", false
+	}
+	for _, prefix := range n.cfg.NearCache.Prefixes {
+		if strings.HasPrefix(keys[0], prefix) {
+			return keys[0], true
+		}
+	}
+	return "", false
+}
+
+// lookup return cached reply of the read, or the empty entry to fill once the reply is known. Both are nil
+// when the read is not cached, ctx from WithPrimaryRead always read redis
+func (n *nearCache) lookup(ctx context.Context, name string, args []interface{}) (entry *nearEntry, reply interface{}, hit bool) {
+	if n == nil || atomic.LoadInt32(&n.ready) == 0 {
+		return nil, nil, false
+	}
+	key, ok := n.cacheable(name, args)
+	if !ok {
+		return nil, nil, false
+	}
+	if primary, _ := ctx.Value(primaryReadKey{}).(bool); primary {
+		return nil, nil, false
+	}
+
+	id := strings.ToUpper(name)
+	for _, a := range args {
+		id += "\x00" + argString(a)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if elem, ok := n.entries[id]; ok {
+		e := elem.Value.(*nearEntry)
+		if e.filled && time.Now().Before(e.expires) {
+			n.lru.MoveToFront(elem)
+			n.observe(true)
+			return nil, e.reply, true
+		}
+		if e.filled {
+			n.remove(elem)
+		} else {
+			// another read of the same command is in flight, let it fill the entry
+			n.observe(false)
+			return nil, nil, false
+		}
+	}
+
+	n.observe(false)
+	entry = &nearEntry{id: id, key: key}
+	elem := n.lru.PushFront(entry)
+	n.entries[id] = elem
+	if n.byKey[key] == nil {
+		n.byKey[key] = make(map[string]*list.Element)
+	}
+	n.byKey[key][id] = elem
+	return entry, nil, false
+}
+
+// fill store reply in entry, unless the entry was invalidated while the read was in flight
+func (n *nearCache) fill(entry *nearEntry, reply interface{}, err error) {
+	if n == nil || entry == nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	elem, ok := n.entries[entry.id]
+	if !ok || elem.Value != entry {
+		return
+	}
+	if err != nil && err != redis.ErrNil {
+		n.remove(elem)
+		return
+	}
+
+	ttl := n.cfg.NearCache.MinTTL
+	if spread := n.cfg.NearCache.MaxTTL - ttl; spread > 0 {
+		ttl += time.Duration(rand.Int63n(int64(spread) + 1))
+	}
+	entry.reply = reply
+	entry.filled = true
+	entry.expires = time.Now().Add(ttl)
+	entry.size = int64(len(entry.id)+len(entry.key)+nearCacheEntryOverhead) + replySize(reply)
+	n.bytes += entry.size
+
+	for n.bytes > n.cfg.NearCache.MaxBytes && n.lru.Len() > 0 {
+		n.remove(n.lru.Back())
+		atomic.AddInt64(&n.evictions, 1)
+	}
+}
+
+// written drop entries of keys changed by cmd, so this process read its own writes without waiting for
+// the invalidation message
+func (n *nearCache) written(cmd *RedisCmd) {
+	if n == nil {
+		return
+	}
+	cmds := cmd.Cmds
+	if !cmd.pipeline {
+		cmds = []*RedisCmd{cmd}
+	}
+	for _, c := range cmds {
+		if readOnlyCommands[strings.ToUpper(c.Name)] {
+			continue
+		}
+		n.invalidate(commandKeys(c.Name, c.Args)...)
+	}
+}
+
+func (n *nearCache) invalidate(keys ...string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, key := range keys {
+		for _, elem := range n.byKey[key] {
+			n.remove(elem)
+		}
+	}
+}
+
+// flush drop every entry, including reads in flight
+func (n *nearCache) flush() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.lru.Init()
+	n.entries = make(map[string]*list.Element)
+	n.byKey = make(map[string]map[string]*list.Element)
+	n.bytes = 0
+}
+
+// remove drop elem from every index. Caller must hold mu
+func (n *nearCache) remove(elem *list.Element) {
+	e := n.lru.Remove(elem).(*nearEntry)
+	delete(n.entries, e.id)
+	if ids := n.byKey[e.key]; ids != nil {
+		delete(ids, e.id)
+		if len(ids) <= 0 {
+			delete(n.byKey, e.key)
+		}
+	}
+	if e.filled {
+		n.bytes -= e.size
+	}
+}
+
+// observe count a hit or miss, reported as the nearcache counter tagged with result
+func (n *nearCache) observe(hit bool) {
+	result := "miss"
+	if hit {
+		atomic.AddInt64(&n.hits, 1)
+		result = "hit"
+	} else {
+		atomic.AddInt64(&n.misses, 1)
+	}
+	if n.instance.metrics != nil {
+		n.instance.metrics.AddCounter("redis", "nearcache", 1, []string{
+			"result:" + result,
+			"ipredis:" + n.cfg.Connection,
+		})
+	}
+}
+
+// replySize estimate memory held by a redis reply
+func replySize(reply interface{}) int64 {
+	switch v := reply.(type) {
+	case []byte:
+		return int64(len(v)) + 24
+	case string:
+		return int64(len(v)) + 16
+	case []interface{}:
+		size := int64(24)
+		for _, item := range v {
+			size += 16 + replySize(item)
+		}
+		return size
+	default:
+		return 16
+	}
+}
+
+// watch keep the invalidation connection subscribed until Close, reconnecting after every failure.
+// The cache is emptied each time the connection is lost since invalidations may have been missed
+func (n *nearCache) watch() {
+	backoff := 100 * time.Millisecond
+	for {
+		err := n.subscribe()
+		atomic.StoreInt32(&n.ready, 0)
+		n.flush()
+		if err == errNearCacheClosed {
+			return
+		}
+		log.Println("[warning][redis] near cache invalidation connection lost, cache bypassed:", err)
+
+		select {
+		case <-n.stop:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 5*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// subscribe open the invalidation connection and handle its messages until it fails
+func (n *nearCache) subscribe() (err error) {
+	c, err := n.dial()
+	if err != nil {
+		return
+	}
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		c.Close()
+		return errNearCacheClosed
+	}
+	n.conn = c
+	n.mu.Unlock()
+	defer c.Close()
+
+	mode := n.cfg.NearCache.Invalidation
+	if mode != NearCacheKeyspace {
+		err = n.enableTracking(c)
+		if err != nil && mode == NearCacheTracking {
+			return
+		}
+		if err == nil {
+			mode = NearCacheTracking
+		} else {
+			mode = NearCacheKeyspace
+		}
+	}
+
+	if mode == NearCacheTracking {
+		c.Send("SUBSCRIBE", "__redis__:invalidate")
+	} else {
+		for _, prefix := range n.cfg.NearCache.Prefixes {
+			c.Send("PSUBSCRIBE", "__keyspace@*__:"+escapeGlob(prefix)+"*")
+		}
+	}
+	if err = c.Flush(); err != nil {
+		return
+	}
+
+	go n.ping(c)
+	for {
+		reply, errReceive := redis.ReceiveWithTimeout(c, 2*nearCachePing)
+		if errReceive != nil {
+			n.mu.Lock()
+			closed := n.closed
+			n.mu.Unlock()
+			if closed {
+				return errNearCacheClosed
+			}
+			return errReceive
+		}
+		n.handle(mode, reply)
+	}
+}
+
+// enableTracking turn on broadcast tracking of the prefixes, redirected to c itself
+func (n *nearCache) enableTracking(c redis.Conn) error {
+	id, err := redis.Int64(c.Do("CLIENT", "ID"))
+	if err != nil {
+		return err
+	}
+	args := []interface{}{"TRACKING", "on", "REDIRECT", id, "BCAST"}
+	for _, prefix := range n.cfg.NearCache.Prefixes {
+		args = append(args, "PREFIX", prefix)
+	}
+	_, err = c.Do("CLIENT", args...)
+	return err
+}
+
+// ping keep the subscribed connection busy so a dead server is noticed by the receive timeout, and report
+// the near cache size
+func (n *nearCache) ping(c redis.Conn) {
+	ticker := time.NewTicker(nearCachePing)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-ticker.C:
+		}
+		if c.Send("PING") != nil || c.Flush() != nil {
+			return
+		}
+		if n.instance.metrics != nil {
+			stats := n.instance.NearCacheStats()
+			n.instance.metrics.SetGauge("redis", "nearcache_bytes", float64(stats.Bytes), []string{"ipredis:" + n.cfg.Connection})
+		}
+	}
+}
+
+// handle apply one message of the invalidation connection
+func (n *nearCache) handle(mode string, reply interface{}) {
+	values, ok := reply.([]interface{})
+	if !ok || len(values) < 3 {
+		return
+	}
+	kind, _ := redis.String(values[0], nil)
+	switch {
+	case kind == "message" && mode == NearCacheTracking:
+		// nil payload is sent when the server flush every key
+		if values[2] == nil {
+			n.flush()
+			return
+		}
+		keys, _ := redis.Strings(values[2], nil)
+		n.invalidate(keys...)
+	case kind == "pmessage" && len(values) >= 4:
+		channel, _ := redis.String(values[2], nil)
+		if idx := strings.Index(channel, "__:"); idx >= 0 {
+			n.invalidate(channel[idx+3:])
+		}
+	case kind == "subscribe" || kind == "psubscribe":
+		atomic.StoreInt32(&n.ready, 1)
+	}
+}
+
+// Close stop the invalidation connection
+func (n *nearCache) Close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	n.closed = true
+	close(n.stop)
+	if n.conn != nil {
+		n.conn.Close()
+	}
+}
+
+// escapeGlob escape glob special characters of a PSUBSCRIBE pattern
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,177 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func newTestNearCache(maxBytes int64) *nearCache {
+	cfg := RedisConfig{Connection: "test"}
+	cfg.NearCache.Prefixes = []string{"user:"}
+	cfg.NearCache.MaxBytes = maxBytes
+	n := newNearCache(&RedisInstance{Config: cfg}, nil)
+	n.ready = 1
+	return n
+}
+
+// nearRead is one cached read, the reply is filled on miss
+func nearRead(n *nearCache, ctx context.Context, name string, reply interface{}, err error, args ...interface{}) (interface{}, bool) {
+	entry, cached, hit := n.lookup(ctx, name, args)
+	if hit {
+		return cached, true
+	}
+	n.fill(entry, reply, err)
+	return reply, false
+}
+
+func TestNearCacheCacheable(t *testing.T) {
+	n := newTestNearCache(0)
+	tests := []struct {
+		name string
+		cmd  string
+		args []interface{}
+		key  string
+		ok   bool
+	}{
+		{name: "read of prefixed key", cmd: "get", args: []interface{}{"user:1"}, key: "user:1", ok: true},
+		{name: "hash read", cmd: "HGETALL", args: []interface{}{"user:1"}, key: "user:1", ok: true},
+		{name: "other prefix", cmd: "GET", args: []interface{}{"order:1"}},
+		{name: "write", cmd: "SET", args: []interface{}{"user:1", "v"}},
+		{name: "several keys", cmd: "MGET", args: []interface{}{"user:1", "user:2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ok := n.cacheable(tt.cmd, tt.args)
+			if key != tt.key || ok != tt.ok {
+				t.Fatalf("cacheable = %q %v, want %q %v", key, ok, tt.key, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNearCacheInvalidation(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		between func(n *nearCache)
+		hit     bool
+	}{
+		{name: "hit", between: func(n *nearCache) {}, hit: true},
+		{name: "own write", between: func(n *nearCache) {
+			n.written(&RedisCmd{Name: "SET", Args: []interface{}{"user:1", "b"}})
+		}},
+		{name: "own write in pipeline", between: func(n *nearCache) {
+			n.written(&RedisCmd{pipeline: true, Cmds: []*RedisCmd{
+				{Name: "GET", Args: []interface{}{"user:1"}},
+				{Name: "DEL", Args: []interface{}{"user:1"}},
+			}})
+		}},
+		{name: "write of another key", between: func(n *nearCache) {
+			n.written(&RedisCmd{Name: "SET", Args: []interface{}{"user:2", "b"}})
+		}, hit: true},
+		{name: "tracking message", between: func(n *nearCache) {
+			n.handle(NearCacheTracking, []interface{}{[]byte("message"), []byte("__redis__:invalidate"), []interface{}{[]byte("user:1")}})
+		}},
+		{name: "tracking flush", between: func(n *nearCache) {
+			n.handle(NearCacheTracking, []interface{}{[]byte("message"), []byte("__redis__:invalidate"), nil})
+		}},
+		{name: "keyspace message", between: func(n *nearCache) {
+			n.handle(NearCacheKeyspace, []interface{}{[]byte("pmessage"), []byte("__keyspace@*__:user:*"), []byte("__keyspace@0__:user:1"), []byte("set")})
+		}},
+		{name: "connection lost", between: func(n *nearCache) { n.flush() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newTestNearCache(0)
+			if _, hit := nearRead(n, ctx, "GET", []byte("a"), nil, "user:1"); hit {
+				t.Fatal("first read hit")
+			}
+			tt.between(n)
+			reply, hit := nearRead(n, ctx, "GET", []byte("b"), nil, "user:1")
+			if hit != tt.hit {
+				t.Fatalf("hit = %v, want %v", hit, tt.hit)
+			}
+			if want := map[bool]string{true: "a", false: "b"}[tt.hit]; string(reply.([]byte)) != want {
+				t.Fatalf("reply = %s, want %s", reply, want)
+			}
+		})
+	}
+}
+
+func TestNearCacheInvalidatedInFlight(t *testing.T) {
+	ctx := context.Background()
+	n := newTestNearCache(0)
+	entry, _, _ := n.lookup(ctx, "GET", []interface{}{"user:1"})
+	if entry == nil {
+		t.Fatal("no entry to fill")
+	}
+	if other, _, hit := n.lookup(ctx, "GET", []interface{}{"user:1"}); other != nil || hit {
+		t.Fatal("concurrent read got an entry to fill")
+	}
+	n.invalidate("user:1")
+	n.fill(entry, []byte("stale"), nil)
+
+	if _, hit := nearRead(n, ctx, "GET", []byte("fresh"), nil, "user:1"); hit {
+		t.Fatal("stale reply cached")
+	}
+}
+
+func TestNearCacheBypass(t *testing.T) {
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		ready int32
+		err   error
+		hit   bool
+	}{
+		{name: "nil reply cached", ctx: context.Background(), ready: 1, err: redis.ErrNil, hit: true},
+		{name: "error not cached", ctx: context.Background(), ready: 1, err: errors.New("i/o timeout")},
+		{name: "primary read", ctx: WithPrimaryRead(context.Background()), ready: 1},
+		{name: "not subscribed", ctx: context.Background(), ready: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newTestNearCache(0)
+			n.ready = tt.ready
+			nearRead(n, tt.ctx, "GET", nil, tt.err, "user:1")
+			if _, hit := nearRead(n, tt.ctx, "GET", nil, nil, "user:1"); hit != tt.hit {
+				t.Fatalf("hit = %v, want %v", hit, tt.hit)
+			}
+		})
+	}
+}
+
+func TestNearCacheEviction(t *testing.T) {
+	ctx := context.Background()
+	value := make([]byte, 100)
+	// room for two entries of value only
+	n := newTestNearCache(2 * (int64(len("GET\x00user:1")+len("user:1")+nearCacheEntryOverhead) + replySize(value)))
+
+	nearRead(n, ctx, "GET", value, nil, "user:1")
+	nearRead(n, ctx, "GET", value, nil, "user:2")
+	// user:1 becomes the most recently used
+	if _, hit := nearRead(n, ctx, "GET", value, nil, "user:1"); !hit {
+		t.Fatal("user:1 not cached")
+	}
+	nearRead(n, ctx, "GET", value, nil, "user:3")
+
+	for _, key := range []string{"user:1", "user:3"} {
+		if _, _, hit := n.lookup(ctx, "GET", []interface{}{key}); !hit {
+			t.Fatalf("%s evicted", key)
+		}
+	}
+	if _, _, hit := n.lookup(ctx, "GET", []interface{}{"user:2"}); hit {
+		t.Fatal("least recently used user:2 not evicted")
+	}
+	if n.evictions < 1 || n.bytes > n.cfg.NearCache.MaxBytes {
+		t.Fatalf("evictions = %d, bytes = %d over %d", n.evictions, n.bytes, n.cfg.NearCache.MaxBytes)
+	}
+
+	n.flush()
+	if n.bytes != 0 || len(n.entries) != 0 || len(n.byKey) != 0 || n.lru.Len() != 0 {
+		t.Fatalf("flush left bytes = %d entries = %d", n.bytes, len(n.entries))
+	}
+}
@@ -0,0 +1,415 @@
+package connection
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+type (
+	// Pipeline queue commands and send them in one round trip on a single pooled connection
+	Pipeline struct {
+		instance *RedisInstance
+		cmds     []pipelined
+	}
+
+	pipelined interface {
+		command() *pipelineCmd
+		decode()
+	}
+
+	pipelineCmd struct {
+		name  string
+		args  []interface{}
+		reply interface{}
+		err   error
+	}
+
+	// PipelineStatus is result of command which only report error
+	PipelineStatus struct {
+		pipelineCmd
+	}
+
+	// PipelineString is result of command replying a single string
+	PipelineString struct {
+		pipelineCmd
+		val string
+	}
+
+	// PipelineInt is result of command replying an integer
+	PipelineInt struct {
+		pipelineCmd
+		val int
+	}
+
+	// PipelineFloat is result of command replying a float
+	PipelineFloat struct {
+		pipelineCmd
+		val float64
+	}
+
+	// PipelineStrings is result of command replying a list
+	PipelineStrings struct {
+		pipelineCmd
+		val []string
+	}
+
+	// PipelineStringMap is result of command replying field value pairs
+	PipelineStringMap struct {
+		pipelineCmd
+		fields []string
+		val    map[string]string
+	}
+)
+
+// Pipeline create new empty pipeline
+func (i *RedisInstance) Pipeline() *Pipeline {
+	return &Pipeline{
+		instance: i,
+	}
+}
+
+func (c *pipelineCmd) command() *pipelineCmd {
+	return c
+}
+
+// Err return error of the command, nil until Exec is called
+func (c *pipelineCmd) Err() error {
+	return c.err
+}
+
+func (c *PipelineStatus) decode() {}
+
+func (c *PipelineString) decode() {
+	if c.err != nil {
+		return
+	}
+	var b []byte
+	b, c.err = redis.Bytes(c.reply, nil)
+	if c.err == redis.ErrNil {
+		c.err = nil
+		return
+	}
+	c.val = string(b)
+}
+
+// Val return string reply, empty when key does not exist
+func (c *PipelineString) Val() (string, error) {
+	return c.val, c.err
+}
+
+func (c *PipelineInt) decode() {
+	if c.err != nil {
+		return
+	}
+	c.val, c.err = redis.Int(c.reply, nil)
+}
+
+// Val return integer reply
+func (c *PipelineInt) Val() (int, error) {
+	return c.val, c.err
+}
+
+func (c *PipelineFloat) decode() {
+	if c.err != nil {
+		return
+	}
+	c.val, c.err = redis.Float64(c.reply, nil)
+	if c.err == redis.ErrNil {
+		c.err = nil
+		c.val = 0
+	}
+}
+
+// Val return float reply, 0 when member does not exist
+func (c *PipelineFloat) Val() (float64, error) {
+	return c.val, c.err
+}
+
+func (c *PipelineStrings) decode() {
+	if c.err != nil {
+		return
+	}
+	c.val, c.err = redis.Strings(c.reply, nil)
+}
+
+// Val return list reply
+func (c *PipelineStrings) Val() ([]string, error) {
+	return c.val, c.err
+}
+
+func (c *PipelineStringMap) decode() {
+	if c.err != nil {
+		return
+	}
+	if c.fields == nil {
+		c.val, c.err = redis.StringMap(c.reply, nil)
+		return
+	}
+
+	var values []string
+	values, c.err = redis.Strings(c.reply, nil)
+	c.val = make(map[string]string)
+	for i, f := range c.fields {
+		if len(values) > i {
+			c.val[f] = values[i]
+		}
+	}
+}
+
+// Val return field value pairs
+func (c *PipelineStringMap) Val() (map[string]string, error) {
+	return c.val, c.err
+}
+
+func newPipelineStatus(name string, args ...interface{}) *PipelineStatus {
+	return &PipelineStatus{pipelineCmd{name: name, args: args}}
+}
+
+func (p *Pipeline) queue(cmd pipelined, name string, args ...interface{}) {
+	c := cmd.command()
+	c.name = name
+	c.args = args
+	p.cmds = append(p.cmds, cmd)
+}
+
+// Len return number of queued commands
+func (p *Pipeline) Len() int {
+	return len(p.cmds)
+}
+
+/*H Command*/
+func (p *Pipeline) HGet(key, field string) *PipelineString {
+	cmd := &PipelineString{}
+	p.queue(cmd, "HGET", key, field)
+	return cmd
+}
+
+func (p *Pipeline) HGetAll(key string) *PipelineStringMap {
+	cmd := &PipelineStringMap{}
+	p.queue(cmd, "HGETALL", key)
+	return cmd
+}
+
+func (p *Pipeline) HMGet(key string, fields []string) *PipelineStringMap {
+	args := []interface{}{key}
+	for _, f := range fields {
+		args = append(args, f)
+	}
+	cmd := &PipelineStringMap{fields: fields}
+	p.queue(cmd, "HMGET", args...)
+	return cmd
+}
+
+func (p *Pipeline) HSet(key, field string, value string) *PipelineStatus {
+	cmd := &PipelineStatus{}
+	p.queue(cmd, "HSET", key, field, value)
+	return cmd
+}
+
+func (p *Pipeline) HMSet(key string, pairs map[string]string) *PipelineStatus {
+	args := []interface{}{key}
+	for k, v := range pairs {
+		args = append(args, k, v)
+	}
+	cmd := &PipelineStatus{}
+	p.queue(cmd, "HMSET", args...)
+	return cmd
+}
+
+func (p *Pipeline) HDel(key string, members []string) *PipelineStatus {
+	args := []interface{}{key}
+	for _, m := range members {
+		args = append(args, m)
+	}
+	cmd := &PipelineStatus{}
+	p.queue(cmd, "HDEL", args...)
+	return cmd
+}
+
+/*Z Command*/
+func (p *Pipeline) ZScore(key, member string) *PipelineFloat {
+	cmd := &PipelineFloat{}
+	p.queue(cmd, "ZSCORE", key, member)
+	return cmd
+}
+
+func (p *Pipeline) ZAdd(key string, pairs map[string]float64) *PipelineInt {
+	args := []interface{}{key}
+	for k, v := range pairs {
+		args = append(args, v, k)
+	}
+	cmd := &PipelineInt{}
+	p.queue(cmd, "ZADD", args...)
+	return cmd
+}
+
+func (p *Pipeline) ZRange(key string, start, stop int) *PipelineStrings {
+	cmd := &PipelineStrings{}
+	p.queue(cmd, "ZRANGE", key, start, stop)
+	return cmd
+}
+
+func (p *Pipeline) ZRevRange(key string, start, stop int) *PipelineStrings {
+	cmd := &PipelineStrings{}
+	p.queue(cmd, "ZREVRANGE", key, start, stop)
+	return cmd
+}
+
+func (p *Pipeline) ZCount(key, min, max string) *PipelineInt {
+	cmd := &PipelineInt{}
+	p.queue(cmd, "ZCOUNT", key, min, max)
+	return cmd
+}
+
+func (p *Pipeline) ZRem(key string, members []string) *PipelineInt {
+	args := []interface{}{key}
+	for _, m := range members {
+		args = append(args, m)
+	}
+	cmd := &PipelineInt{}
+	p.queue(cmd, "ZREM", args...)
+	return cmd
+}
+
+func (p *Pipeline) ZRemRangeByScore(key, min, max string) *PipelineInt {
+	cmd := &PipelineInt{}
+	p.queue(cmd, "ZREMRANGEBYSCORE", key, min, max)
+	return cmd
+}
+
+/*Generic Command*/
+func (p *Pipeline) SMembers(key string) *PipelineStrings {
+	cmd := &PipelineStrings{}
+	p.queue(cmd, "SMEMBERS", key)
+	return cmd
+}
+
+func (p *Pipeline) LRange(key string, startIndex int, endIndex int) *PipelineStrings {
+	cmd := &PipelineStrings{}
+	p.queue(cmd, "LRANGE", key, startIndex, endIndex)
+	return cmd
+}
+
+func (p *Pipeline) Expire(key string, seconds int) *PipelineInt {
+	cmd := &PipelineInt{}
+	p.queue(cmd, "EXPIRE", key, seconds)
+	return cmd
+}
+
+func (p *Pipeline) PExpire(key string, ttl time.Duration) *PipelineInt {
+	cmd := &PipelineInt{}
+	p.queue(cmd, "PEXPIRE", key, int64(ttl/time.Millisecond))
+	return cmd
+}
+
+func (p *Pipeline) Delete(key string) *PipelineStatus {
+	cmd := &PipelineStatus{}
+	p.queue(cmd, "DEL", key)
+	return cmd
+}
+
+func (p *Pipeline) Get(key string) *PipelineString {
+	cmd := &PipelineString{}
+	p.queue(cmd, "GET", key)
+	return cmd
+}
+
+func (p *Pipeline) Set(key string, value string, expireSeconds int) *PipelineStatus {
+	cmd := &PipelineStatus{}
+	if expireSeconds <= 0 {
+		p.queue(cmd, "SET", key, value)
+	} else {
+		p.queue(cmd, "SETEX", key, expireSeconds, value)
+	}
+	return cmd
+}
+
+// Exec is ExecCtx without deadline
+func (p *Pipeline) Exec(datadogAdditionalInfo map[string]string) (err error) {
+	return p.ExecCtx(context.Background(), datadogAdditionalInfo)
+}
+
+// ExecCtx send every queued command in one Send/Flush/Receive cycle. Per command error is kept in
+// each result, returned err is only set when the connection itself failed. The whole pipeline is sent
+// again on retryable error when Config.Retry allows it for every command. Pipeline is empty after exec
+func (p *Pipeline) ExecCtx(ctx context.Context, datadogAdditionalInfo map[string]string) (err error) {
+	cmds := p.cmds
+	p.cmds = nil
+	if len(cmds) <= 0 {
+		return
+	}
+
+	p.instance.prefixCmds(cmds)
+	cmd := &RedisCmd{
+		Type:     "pipeline",
+		Cmds:     hookCmds(cmds),
+		Info:     datadogAdditionalInfo,
+		Tags:     []string{"commands:" + strconv.Itoa(len(cmds))},
+		pipeline: true,
+	}
+	_, err = p.instance.processRetry(ctx, cmd, func(ctx context.Context) (interface{}, error) {
+		resetPipelined(cmds)
+		errExec := p.instance.execPipeline(ctx, cmds)
+		setHookReplies(cmd.Cmds, cmds)
+		return nil, errExec
+	})
+	return
+}
+
+func (i *RedisInstance) execPipeline(ctx context.Context, cmds []pipelined) (err error) {
+	defer func() {
+		for _, cmd := range cmds {
+			c := cmd.command()
+			if err != nil && c.err == nil {
+				c.err = err
+			}
+			cmd.decode()
+		}
+	}()
+
+	rdsConn, errConn := i.getConn(ctx)
+	if errConn != nil {
+		err = errConn
+
+		return
+	}
+	defer func() {
+		errRdsConn := rdsConn.Close()
+		if errRdsConn != nil && err == nil {
+			err = errRdsConn
+		}
+	}()
+
+	for _, cmd := range cmds {
+		c := cmd.command()
+		if err = rdsConn.Send(c.name, c.args...); err != nil {
+			return
+		}
+	}
+	// empty command flush the buffer and read every pending reply, redis error reply is kept inline
+	var replies []interface{}
+	replies, err = redis.Values(doCtx(ctx, rdsConn, ""))
+	if err != nil {
+		return
+	}
+	assignReplies(cmds, replies)
+	return
+}
+
+// assignReplies spread replies of a pipeline or EXEC to its commands, redis error reply become command error
+func assignReplies(cmds []pipelined, replies []interface{}) {
+	for idx, cmd := range cmds {
+		if idx >= len(replies) {
+			break
+		}
+		c := cmd.command()
+		if errReply, ok := replies[idx].(redis.Error); ok {
+			c.err = errReply
+			continue
+		}
+		c.reply = replies[idx]
+	}
+}
@@ -0,0 +1,217 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+const (
+	subscriberPingInterval   = 30 * time.Second
+	subscriberMaxReconnDelay = 30 * time.Second
+)
+
+// ErrRedisSubscriberClosed is returned when Subscriber is used after Close
+var ErrRedisSubscriberClosed = errors.New("[error][redis] subscriber is closed")
+
+type (
+	// SubscriberMessage is a message received on a subscribed channel. Pattern is set when
+	// the message matched a PSUBSCRIBE pattern
+	SubscriberMessage struct {
+		Channel string
+		Pattern string
+		Data    []byte
+	}
+
+	// SubscriberHandler is called for every message, in the subscriber goroutine
+	SubscriberHandler func(msg SubscriberMessage)
+
+	// Subscriber keep a dedicated connection subscribed to channels and patterns. The connection
+	// is made outside RedisPool, and is redialed and resubscribed after any error until Close
+	Subscriber struct {
+		instance *RedisInstance
+		channels []interface{}
+		patterns []interface{}
+		handler  SubscriberHandler
+		messages chan SubscriberMessage
+
+		mu     sync.Mutex
+		psc    *redis.PubSubConn
+		closed bool
+		stop   chan struct{}
+		done   chan struct{}
+	}
+)
+
+/*Pub/Sub Command*/
+func (i *RedisInstance) Publish(channel string, message string, datadogAdditionalInfo map[string]string) (receivers int, err error) {
+	return i.PublishCtx(context.Background(), channel, message, datadogAdditionalInfo)
+}
+
+// PublishCtx is Publish bounded by ctx
+func (i *RedisInstance) PublishCtx(ctx context.Context, channel string, message string, datadogAdditionalInfo map[string]string) (receivers int, err error) {
+	return redis.Int(i.run(ctx, "publish", datadogAdditionalInfo, "PUBLISH", channel, message))
+}
+
+// Subscribe start a subscriber on channels and patterns. Messages are given to handler, or when
+// handler is nil, sent to Messages() which must then be drained by the caller
+func (i *RedisInstance) Subscribe(channels []string, patterns []string, handler SubscriberHandler) *Subscriber {
+	s := &Subscriber{
+		instance: i,
+		handler:  handler,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, c := range channels {
+		s.channels = append(s.channels, c)
+	}
+	for _, p := range patterns {
+		s.patterns = append(s.patterns, p)
+	}
+	if handler == nil {
+		s.messages = make(chan SubscriberMessage, 100)
+	}
+
+	go s.run()
+	return s
+}
+
+// Messages return channel of received messages, nil when subscriber has a handler. It is closed on Close
+func (s *Subscriber) Messages() <-chan SubscriberMessage {
+	return s.messages
+}
+
+func (s *Subscriber) run() {
+	defer close(s.done)
+	if s.messages != nil {
+		defer close(s.messages)
+	}
+
+	delay := time.Second
+	for {
+		started := time.Now()
+		err := s.listen()
+		if s.isClosed() {
+			return
+		}
+		log.Println("[warning][redis] subscriber disconnected", err)
+
+		// connection that lived long enough was healthy, start backoff over
+		if time.Since(started) > subscriberMaxReconnDelay {
+			delay = time.Second
+		}
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > subscriberMaxReconnDelay {
+			delay = subscriberMaxReconnDelay
+		}
+	}
+}
+
+func (s *Subscriber) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// listen subscribe on a new connection and deliver messages until the connection fail
+func (s *Subscriber) listen() error {
+	c, err := s.instance.dial()
+	if err != nil {
+		return err
+	}
+	psc := &redis.PubSubConn{Conn: c}
+	defer psc.Close()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrRedisSubscriberClosed
+	}
+	s.psc = psc
+	s.mu.Unlock()
+
+	if len(s.channels) > 0 {
+		if err = psc.Subscribe(s.channels...); err != nil {
+			return err
+		}
+	}
+	if len(s.patterns) > 0 {
+		if err = psc.PSubscribe(s.patterns...); err != nil {
+			return err
+		}
+	}
+
+	// ping keep the connection checked while no message come, missing pong make the receive time out
+	pingDone := make(chan struct{})
+	defer close(pingDone)
+	go func() {
+		ticker := time.NewTicker(subscriberPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-pingDone:
+				return
+			case <-ticker.C:
+				if errPing := psc.Ping(""); errPing != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		switch v := psc.ReceiveWithTimeout(2 * subscriberPingInterval).(type) {
+		case redis.Message:
+			if !s.deliver(SubscriberMessage{Channel: v.Channel, Data: v.Data}) {
+				return ErrRedisSubscriberClosed
+			}
+		case redis.PMessage:
+			if !s.deliver(SubscriberMessage{Channel: v.Channel, Pattern: v.Pattern, Data: v.Data}) {
+				return ErrRedisSubscriberClosed
+			}
+		case error:
+			return v
+		}
+	}
+}
+
+func (s *Subscriber) deliver(msg SubscriberMessage) bool {
+	if s.handler != nil {
+		s.handler(msg)
+		return true
+	}
+	select {
+	case s.messages <- msg:
+		return true
+	case <-s.stop:
+		return false
+	}
+}
+
+// Close close the subscribed connection and wait until the subscriber goroutine exit
+func (s *Subscriber) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrRedisSubscriberClosed
+	}
+	s.closed = true
+	close(s.stop)
+	if s.psc != nil {
+		// closing the connection drop the subscriptions server side and unblock the pending receive
+		s.psc.Close()
+	}
+	s.mu.Unlock()
+
+	<-s.done
+	return nil
+}
@@ -0,0 +1,224 @@
+package connection
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Replica selection of RedisConfig.ReplicaSelection
+const (
+	ReplicaRoundRobin    = "round_robin"
+	ReplicaLowestLatency = "lowest_latency"
+)
+
+// readOnlyCommands can be served by a replica
+var readOnlyCommands = map[string]bool{
+	"EXISTS":           true,
+	"GET":              true,
+	"HGET":             true,
+	"HGETALL":          true,
+	"HLEN":             true,
+	"HMGET":            true,
+	"LRANGE":           true,
+	"MGET":             true,
+	"SDIFF":            true,
+	"SINTER":           true,
+	"SMEMBERS":         true,
+	"SUNION":           true,
+	"TYPE":             true,
+	"XRANGE":           true,
+	"ZCOUNT":           true,
+	"ZRANGE":           true,
+	"ZRANGEBYSCORE":    true,
+	"ZREVRANGE":        true,
+	"ZREVRANGEBYSCORE": true,
+	"ZSCORE":           true,
+}
+
+type (
+	// redisReplicas hold one pool per read replica
+	redisReplicas struct {
+		selection string
+		replicas  []*redisReplica
+		next      uint64
+	}
+
+	redisReplica struct {
+		addr string
+		pool *redis.Pool
+		// latency is the moving average of command latency in nanosecond, 0 until first measure
+		latency int64
+		// failures count consecutive connection errors. A failing replica is skipped until retryAt, unix
+		// nanosecond, then one read probe it
+		failures int64
+		retryAt  int64
+	}
+
+	// primaryReadKey mark a ctx whose reads must go to the primary
+	primaryReadKey struct{}
+)
+
+// WithPrimaryRead return ctx whose read commands are sent to the primary instead of a replica, to read
+// back a write made just before
+func WithPrimaryRead(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryReadKey{}, true)
+}
+
+func newRedisReplicas(cfg RedisConfig) (*redisReplicas, error) {
+	r := &redisReplicas{selection: cfg.ReplicaSelection}
+	for _, addr := range cfg.ReplicaAddrs {
+		pool, err := newRedisPool(cfg, addr)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.replicas = append(r.replicas, &redisReplica{addr: addr, pool: pool})
+	}
+	return r, nil
+}
+
+// Close release pooled connections of every replica
+func (r *redisReplicas) Close() {
+	for _, replica := range r.replicas {
+		replica.pool.Close()
+	}
+}
+
+// pick return replica serving the next read, nil when every replica is failing. A failing replica whose
+// backoff is over is picked first, for one probe read. Lowest latency selection only compare measured
+// replicas and still send one read out of 16 round robin, so unmeasured or slow replicas are measured again
+func (r *redisReplicas) pick() *redisReplica {
+	now := time.Now().UnixNano()
+	for _, replica := range r.replicas {
+		if replica.claimProbe(now) {
+			return replica
+		}
+	}
+
+	n := atomic.AddUint64(&r.next, 1)
+	idx := n
+	if r.selection == ReplicaLowestLatency {
+		if n%16 != 0 {
+			if best := r.fastest(); best != nil {
+				return best
+			}
+		} else {
+			// sample reads rotate over replicas on their own, n%16 alone would always hit the same ones
+			idx = n / 16
+		}
+	}
+	for offset := range r.replicas {
+		replica := r.replicas[(idx+uint64(offset))%uint64(len(r.replicas))]
+		if replica.healthy() {
+			return replica
+		}
+	}
+	return nil
+}
+
+// fastest return the healthy replica of lowest measured latency, nil when none was measured yet
+func (r *redisReplicas) fastest() (best *redisReplica) {
+	for _, replica := range r.replicas {
+		latency := atomic.LoadInt64(&replica.latency)
+		if !replica.healthy() || latency <= 0 {
+			continue
+		}
+		if best == nil || latency < atomic.LoadInt64(&best.latency) {
+			best = replica
+		}
+	}
+	return
+}
+
+func (r *redisReplica) healthy() bool {
+	return atomic.LoadInt64(&r.failures) == 0
+}
+
+// claimProbe tell whether the caller may probe failing replica r. Only one caller win, the next probe
+// wait for another backoff
+func (r *redisReplica) claimProbe(now int64) bool {
+	failures := atomic.LoadInt64(&r.failures)
+	retryAt := atomic.LoadInt64(&r.retryAt)
+	if failures == 0 || now < retryAt {
+		return false
+	}
+	return atomic.CompareAndSwapInt64(&r.retryAt, retryAt, now+int64(replicaBackoff(failures)))
+}
+
+// failed eject r for a backoff doubling from 1 second up to 30 second with consecutive failures
+func (r *redisReplica) failed() {
+	failures := atomic.AddInt64(&r.failures, 1)
+	atomic.StoreInt64(&r.retryAt, time.Now().Add(replicaBackoff(failures)).UnixNano())
+}
+
+func (r *redisReplica) succeeded() {
+	if atomic.LoadInt64(&r.failures) != 0 {
+		atomic.StoreInt64(&r.failures, 0)
+	}
+}
+
+func replicaBackoff(failures int64) time.Duration {
+	if failures > 5 {
+		return 30 * time.Second
+	}
+	return time.Second << uint(failures-1)
+}
+
+// observe fold elapsed into the replica moving average
+func (r *redisReplica) observe(elapsed time.Duration) {
+	for {
+		old := atomic.LoadInt64(&r.latency)
+		avg := int64(elapsed)
+		if old > 0 {
+			avg = old + (int64(elapsed)-old)/8
+		}
+		if atomic.CompareAndSwapInt64(&r.latency, old, avg) {
+			return
+		}
+	}
+}
+
+// replicaFor return replica serving command name, nil when it must go to the primary
+func (i *RedisInstance) replicaFor(ctx context.Context, name string) *redisReplica {
+	if i.replicas == nil || len(i.replicas.replicas) <= 0 || !readOnlyCommands[strings.ToUpper(name)] {
+		return nil
+	}
+	if primary, _ := ctx.Value(primaryReadKey{}).(bool); primary {
+		return nil
+	}
+	return i.replicas.pick()
+}
+
+// read send a read to r. served is false when r could not be reached, r is then marked failed and the
+// read must go to the primary. A full pool of r is not a failure of r, the read go to the primary without
+// ejecting it
+func (r *redisReplica) read(ctx context.Context, i *RedisInstance, name string, args ...interface{}) (reply interface{}, served bool, err error) {
+	rdsConn, err := getPooled(ctx, r.pool, i.Config.PoolWaitTimeout, i.waits)
+	if err != nil {
+		if ctxErr(ctx) != nil {
+			return nil, true, err
+		}
+		if err != ErrRedisPoolExhausted {
+			r.failed()
+		}
+		return nil, false, err
+	}
+	defer rdsConn.Close()
+
+	start := time.Now()
+	reply, err = doCtx(ctx, rdsConn, name, args...)
+	if _, isReply := err.(redis.Error); err == nil || err == redis.ErrNil || isReply {
+		r.succeeded()
+		r.observe(time.Since(start))
+		return reply, true, err
+	}
+	if ctxErr(ctx) != nil {
+		return reply, true, err
+	}
+	r.failed()
+	return nil, false, err
+}
@@ -0,0 +1,153 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestReplicaPick(t *testing.T) {
+	past, future := time.Now().Add(-time.Second).UnixNano(), time.Now().Add(time.Hour).UnixNano()
+	tests := []struct {
+		name      string
+		selection string
+		replicas  []redisReplica
+		want      string
+	}{
+		{
+			name:      "round robin",
+			selection: ReplicaRoundRobin,
+			replicas:  []redisReplica{{addr: "a"}, {addr: "b"}},
+			want:      "b",
+		},
+		{
+			name:      "lowest latency ignore unmeasured",
+			selection: ReplicaLowestLatency,
+			replicas:  []redisReplica{{addr: "a"}, {addr: "b", latency: 5e6}, {addr: "c", latency: 1e6}},
+			want:      "c",
+		},
+		{
+			name:      "lowest latency without measure fall back to round robin",
+			selection: ReplicaLowestLatency,
+			replicas:  []redisReplica{{addr: "a"}, {addr: "b"}},
+			want:      "b",
+		},
+		{
+			name:      "failing replica skipped",
+			selection: ReplicaLowestLatency,
+			replicas:  []redisReplica{{addr: "a", latency: 5e6}, {addr: "b", latency: 1e6, failures: 1, retryAt: future}},
+			want:      "a",
+		},
+		{
+			name:      "failing replica probed after backoff",
+			selection: ReplicaRoundRobin,
+			replicas:  []redisReplica{{addr: "a"}, {addr: "b", failures: 2, retryAt: past}},
+			want:      "b",
+		},
+		{
+			name:      "every replica failing",
+			selection: ReplicaRoundRobin,
+			replicas:  []redisReplica{{addr: "a", failures: 1, retryAt: future}, {addr: "b", failures: 3, retryAt: future}},
+			want:      "",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &redisReplicas{selection: tc.selection}
+			for idx := range tc.replicas {
+				r.replicas = append(r.replicas, &tc.replicas[idx])
+			}
+			got := ""
+			if replica := r.pick(); replica != nil {
+				got = replica.addr
+			}
+			if got != tc.want {
+				t.Fatalf("pick %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReplicaProbeClaimedOnce(t *testing.T) {
+	failing := &redisReplica{addr: "b", failures: 1, retryAt: time.Now().Add(-time.Second).UnixNano()}
+	r := &redisReplicas{replicas: []*redisReplica{{addr: "a"}, failing}}
+	if replica := r.pick(); replica != failing {
+		t.Fatalf("first pick %v, want the probe of b", replica)
+	}
+	for n := 0; n < 4; n++ {
+		if replica := r.pick(); replica == failing {
+			t.Fatalf("pick %d probed b again before its backoff", n)
+		}
+	}
+}
+
+func TestReplicaBackoff(t *testing.T) {
+	tests := []struct {
+		failures int64
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{5, 16 * time.Second},
+		{6, 30 * time.Second},
+		{100, 30 * time.Second},
+	}
+	for _, tc := range tests {
+		if got := replicaBackoff(tc.failures); got != tc.want {
+			t.Errorf("replicaBackoff(%d) = %s, want %s", tc.failures, got, tc.want)
+		}
+	}
+}
+
+func TestReplicaReadEjectOnlyOnConnectionError(t *testing.T) {
+	pipeDial := func() (redis.Conn, error) {
+		c, _ := net.Pipe()
+		return redis.NewConn(c, 0, 0), nil
+	}
+	tests := []struct {
+		name    string
+		pool    *redis.Pool
+		hold    bool
+		err     error
+		healthy bool
+	}{
+		{
+			name:    "pool exhausted",
+			pool:    &redis.Pool{MaxActive: 1, Dial: pipeDial},
+			hold:    true,
+			err:     ErrRedisPoolExhausted,
+			healthy: true,
+		},
+		{
+			name: "dial error",
+			pool: &redis.Pool{Dial: func() (redis.Conn, error) {
+				return nil, errors.New("connection refused")
+			}},
+			healthy: false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			defer tc.pool.Close()
+			if tc.hold {
+				held := tc.pool.Get()
+				defer held.Close()
+			}
+			replica := &redisReplica{addr: "a", pool: tc.pool}
+			_, served, err := replica.read(context.Background(), &RedisInstance{}, "GET", "k")
+			if served || err == nil {
+				t.Fatalf("read served %v err %v, want not served", served, err)
+			}
+			if tc.err != nil && err != tc.err {
+				t.Fatalf("read err %v, want %v", err, tc.err)
+			}
+			if replica.healthy() != tc.healthy {
+				t.Fatalf("healthy %v, want %v", replica.healthy(), tc.healthy)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package connection
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// nonIdempotentCommands may apply twice when retried after the reply was lost. Count and position based
+// list commands such as LREM or LTRIM 1 -1 remove more on each replay, pops lose the popped value
+var nonIdempotentCommands = map[string]bool{
+	"APPEND":       true,
+	"BLMOVE":       true,
+	"BLMPOP":       true,
+	"BLPOP":        true,
+	"BRPOP":        true,
+	"BRPOPLPUSH":   true,
+	"BZMPOP":       true,
+	"BZPOPMAX":     true,
+	"BZPOPMIN":     true,
+	"DECR":         true,
+	"DECRBY":       true,
+	"EVAL":         true,
+	"EVALSHA":      true,
+	"GETDEL":       true,
+	"HINCRBY":      true,
+	"HINCRBYFLOAT": true,
+	"INCR":         true,
+	"INCRBY":       true,
+	"INCRBYFLOAT":  true,
+	"LINSERT":      true,
+	"LMOVE":        true,
+	"LMPOP":        true,
+	"LPOP":         true,
+	"LPUSH":        true,
+	"LPUSHX":       true,
+	"LREM":         true,
+	"LSET":         true,
+	"LTRIM":        true,
+	"MSETNX":       true,
+	"PUBLISH":      true,
+	"RENAME":       true,
+	"RENAMENX":     true,
+	"RPOP":         true,
+	"RPOPLPUSH":    true,
+	"RPUSH":        true,
+	"RPUSHX":       true,
+	"SETNX":        true,
+	"SMOVE":        true,
+	"SPOP":         true,
+	"XADD":         true,
+	"XAUTOCLAIM":   true,
+	"XCLAIM":       true,
+	"XREADGROUP":   true,
+	"ZINCRBY":      true,
+	"ZMPOP":        true,
+	"ZPOPMAX":      true,
+	"ZPOPMIN":      true,
+}
+
+// transientReplies are redis error reply prefixes of a node not ready to serve yet
+var transientReplies = []string{"LOADING", "TRYAGAIN", "READONLY", "MASTERDOWN", "CLUSTERDOWN"}
+
+// RetryableRedisError tell whether err is transient: connection closed or reset, network timeout, or
+// one of the LOADING, TRYAGAIN, READONLY, MASTERDOWN and CLUSTERDOWN replies. Caller cancellation,
+// open circuit breaker and exhausted pool are not retryable
+func RetryableRedisError(err error) bool {
+	switch err {
+	case nil, redis.ErrNil, redis.ErrPoolExhausted, ErrRedisPoolExhausted, ErrRedisCanceled, ErrRedisDeadlineExceeded, ErrRedisCircuitOpen:
+		return false
+	case io.EOF, io.ErrUnexpectedEOF, syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.EPIPE:
+		return true
+	}
+
+	if errReply, ok := err.(redis.Error); ok {
+		for _, prefix := range transientReplies {
+			if strings.HasPrefix(string(errReply), prefix) {
+				return true
+			}
+		}
+		return false
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "connection reset") || strings.Contains(msg, "broken pipe") ||
+		strings.Contains(msg, "use of closed network connection")
+}
+
+// idempotent tell whether command name can be sent again safely, SET NX is a conditional write
+func idempotent(name string, args []interface{}) bool {
+	name = strings.ToUpper(name)
+	if nonIdempotentCommands[name] {
+		return false
+	}
+	if name == "SET" {
+		for _, a := range args {
+			if strings.EqualFold(argString(a), "NX") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// retryAttempts return how many times cmd may be sent
+func (i *RedisInstance) retryAttempts(cmd *RedisCmd) int {
+	cfg := i.Config.Retry
+	if cfg.MaxAttempts <= 1 {
+		return 1
+	}
+	if cfg.RetryNonIdempotent {
+		return cfg.MaxAttempts
+	}
+	if !cmd.pipeline && !idempotent(cmd.Name, cmd.Args) {
+		return 1
+	}
+	for _, c := range cmd.Cmds {
+		if !idempotent(c.Name, c.Args) {
+			return 1
+		}
+	}
+	return cfg.MaxAttempts
+}
+
+// retryBackoff return wait before retry number n, starting at 1
+func (i *RedisInstance) retryBackoff(n int) time.Duration {
+	minBackoff, maxBackoff := i.Config.Retry.MinBackoff, i.Config.Retry.MaxBackoff
+	if minBackoff <= 0 {
+		minBackoff = 8 * time.Millisecond
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = 512 * time.Millisecond
+	}
+
+	// doubled step by step and clamped before it can overflow, whatever n and the bounds are
+	backoff := minBackoff
+	for step := 1; step < n && backoff < maxBackoff; step++ {
+		if backoff > maxBackoff/2 {
+			backoff = maxBackoff
+			break
+		}
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// processRetry run cmd through process, sending it again with backoff while it fails with a retryable
+// error. Every attempt goes through the hooks, retries are tagged retry:n
+func (i *RedisInstance) processRetry(ctx context.Context, cmd *RedisCmd, fn func(ctx context.Context) (interface{}, error)) (reply interface{}, err error) {
+	retryable := i.Config.Retry.Retryable
+	if retryable == nil {
+		retryable = RetryableRedisError
+	}
+	attempts := i.retryAttempts(cmd)
+	tags := cmd.Tags
+
+	for n := 0; ; n++ {
+		if n > 0 {
+			cmd.Tags = append(append([]string{}, tags...), "retry:"+strconv.Itoa(n))
+			cmd.Reply, cmd.Err = nil, nil
+		}
+		reply, err = i.process(ctx, cmd, fn)
+		if err == nil || n+1 >= attempts || !retryable(err) {
+			return
+		}
+
+		timer := time.NewTimer(i.retryBackoff(n + 1))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// resetPipelined clear results of cmds before they are sent again
+func resetPipelined(cmds []pipelined) {
+	for _, cmd := range cmds {
+		c := cmd.command()
+		c.reply, c.err = nil, nil
+	}
+}
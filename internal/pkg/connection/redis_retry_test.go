@@ -0,0 +1,117 @@
+package connection
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestRetryableRedisError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{redis.ErrNil, false},
+		{ErrRedisPoolExhausted, false},
+		{ErrRedisCanceled, false},
+		{ErrRedisDeadlineExceeded, false},
+		{ErrRedisCircuitOpen, false},
+		{io.EOF, true},
+		{syscall.ECONNRESET, true},
+		{&net.OpError{Op: "read", Err: syscall.ECONNRESET}, true},
+		{redis.Error("LOADING Redis is loading the dataset in memory"), true},
+		{redis.Error("READONLY You can't write against a read only replica."), true},
+		{redis.Error("CLUSTERDOWN The cluster is down"), true},
+		{redis.Error("WRONGTYPE Operation against a key holding the wrong kind of value"), false},
+		{errors.New("write: broken pipe"), true},
+		{errors.New("unexpected reply"), false},
+	}
+	for _, tc := range tests {
+		if got := RetryableRedisError(tc.err); got != tc.want {
+			t.Errorf("RetryableRedisError(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	tests := []struct {
+		name string
+		args []interface{}
+		want bool
+	}{
+		{"GET", []interface{}{"k"}, true},
+		{"set", []interface{}{"k", "v"}, true},
+		{"SET", []interface{}{"k", "v", "nx"}, false},
+		{"SET", []interface{}{"k", "v", "EX", 10, "NX"}, false},
+		{"HSET", []interface{}{"k", "f", "v"}, true},
+		{"INCR", []interface{}{"k"}, false},
+		{"lrem", []interface{}{"k", 1, "v"}, false},
+		{"LTRIM", []interface{}{"k", 1, -1}, false},
+		{"BLPOP", []interface{}{"k", 0}, false},
+		{"ZPOPMIN", []interface{}{"k"}, false},
+		{"EVALSHA", []interface{}{"sha", 0}, false},
+	}
+	for _, tc := range tests {
+		if got := idempotent(tc.name, tc.args); got != tc.want {
+			t.Errorf("idempotent(%s %v) = %v, want %v", tc.name, tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestRetryAttempts(t *testing.T) {
+	get := &RedisCmd{Name: "GET", Args: []interface{}{"k"}}
+	incr := &RedisCmd{Name: "INCR", Args: []interface{}{"k"}}
+	pipeline := &RedisCmd{pipeline: true, Cmds: []*RedisCmd{get, incr}}
+	tests := []struct {
+		name  string
+		retry RetryConfig
+		cmd   *RedisCmd
+		want  int
+	}{
+		{"disabled", RetryConfig{}, get, 1},
+		{"idempotent", RetryConfig{MaxAttempts: 3}, get, 3},
+		{"non idempotent", RetryConfig{MaxAttempts: 3}, incr, 1},
+		{"non idempotent allowed", RetryConfig{MaxAttempts: 3, RetryNonIdempotent: true}, incr, 3},
+		{"pipeline with a non idempotent command", RetryConfig{MaxAttempts: 3}, pipeline, 1},
+	}
+	for _, tc := range tests {
+		i := &RedisInstance{Config: RedisConfig{Retry: tc.retry}}
+		if got := i.retryAttempts(tc.cmd); got != tc.want {
+			t.Errorf("%s: %d attempts, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		min, max time.Duration
+		n        int
+		// the wait is drawn between half of backoff and backoff
+		backoff time.Duration
+	}{
+		{"default first", 0, 0, 1, 8 * time.Millisecond},
+		{"default doubled", 0, 0, 3, 32 * time.Millisecond},
+		{"default capped", 0, 0, 20, 512 * time.Millisecond},
+		{"min above max", time.Second, 100 * time.Millisecond, 1, 100 * time.Millisecond},
+		{"many attempts", 10 * time.Second, time.Hour, 1000, time.Hour},
+		{"max near overflow", time.Second, math.MaxInt64, 100, math.MaxInt64},
+		{"shift past int64", 10 * time.Second, math.MaxInt64, 31, math.MaxInt64},
+	}
+	for _, tc := range tests {
+		i := &RedisInstance{Config: RedisConfig{Retry: RetryConfig{MinBackoff: tc.min, MaxBackoff: tc.max}}}
+		for draw := 0; draw < 20; draw++ {
+			got := i.retryBackoff(tc.n)
+			if got < tc.backoff/2 || got > tc.backoff {
+				t.Fatalf("%s: backoff %s, want between %s and %s", tc.name, got, tc.backoff/2, tc.backoff)
+			}
+		}
+	}
+}
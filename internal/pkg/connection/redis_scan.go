@@ -0,0 +1,201 @@
+package connection
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+const (
+	defaultScanCount = 100
+	maxScanCount     = 1000
+)
+
+type (
+	// ScanOptions filter and size a cursor iteration. Count is a hint of elements per round trip,
+	// default 100 and capped at 1000 so one call never block the server for long
+	ScanOptions struct {
+		Match string
+		Count int
+		// Type filter SCAN by value type (string, hash, zset, ...), redis 6 or later. Ignored by HSCAN, SSCAN and ZSCAN
+		Type string
+
+		DatadogAdditionalInfo map[string]string
+	}
+
+	// ScanIterator walk a keyspace or a collection with its cursor command. Usage:
+	//
+	//	it := rds.Scan(ctx, ScanOptions{Match: "product:*"})
+	//	for it.Next() {
+	//		key := it.Val()
+	//	}
+	//	err := it.Err()
+	//
+	// Like the underlying commands, an element may be returned more than once
+	ScanIterator struct {
+		instance *RedisInstance
+		ctx      context.Context
+		cmd      string
+		key      string
+		opt      ScanOptions
+		pairs    bool
+
+		// nodes is every master to walk in cluster mode, empty otherwise
+		nodes  []string
+		cursor string
+		buf    []string
+		val    string
+		value  string
+		err    error
+	}
+)
+
+// Scan iterate keys of the database, or of every master in cluster mode
+func (i *RedisInstance) Scan(ctx context.Context, opt ScanOptions) *ScanIterator {
+	it := i.newScanIterator(ctx, "SCAN", "", opt, false)
+	if i.cluster != nil {
+		it.nodes = i.cluster.masters()
+	}
+	return it
+}
+
+// HScan iterate field and value of hash key, read them with Val and Value
+func (i *RedisInstance) HScan(ctx context.Context, key string, opt ScanOptions) *ScanIterator {
+	return i.newScanIterator(ctx, "HSCAN", key, opt, true)
+}
+
+// SScan iterate members of set key
+func (i *RedisInstance) SScan(ctx context.Context, key string, opt ScanOptions) *ScanIterator {
+	return i.newScanIterator(ctx, "SSCAN", key, opt, false)
+}
+
+// ZScan iterate member and score of sorted set key, read them with Val and Value
+func (i *RedisInstance) ZScan(ctx context.Context, key string, opt ScanOptions) *ScanIterator {
+	return i.newScanIterator(ctx, "ZSCAN", key, opt, true)
+}
+
+func (i *RedisInstance) newScanIterator(ctx context.Context, cmd, key string, opt ScanOptions, pairs bool) *ScanIterator {
+	if opt.Count <= 0 {
+		opt.Count = defaultScanCount
+	}
+	if opt.Count > maxScanCount {
+		opt.Count = maxScanCount
+	}
+	return &ScanIterator{
+		instance: i,
+		ctx:      ctx,
+		cmd:      cmd,
+		key:      key,
+		opt:      opt,
+		pairs:    pairs,
+	}
+}
+
+// Next advance to the next element, fetching a new batch when needed. It return false at the end or on error
+func (it *ScanIterator) Next() bool {
+	for {
+		if it.err != nil {
+			return false
+		}
+		if it.pairs && len(it.buf) >= 2 {
+			it.val, it.value, it.buf = it.buf[0], it.buf[1], it.buf[2:]
+			return true
+		}
+		if !it.pairs && len(it.buf) >= 1 {
+			it.val, it.buf = it.buf[0], it.buf[1:]
+			return true
+		}
+
+		if it.cursor == "0" {
+			// current node is finished, move on to the next master in cluster mode
+			if len(it.nodes) <= 1 {
+				return false
+			}
+			it.nodes = it.nodes[1:]
+			it.cursor = ""
+		}
+		if it.err = ctxErr(it.ctx); it.err != nil {
+			return false
+		}
+		it.fetch()
+	}
+}
+
+func (it *ScanIterator) fetch() {
+	cursor := it.cursor
+	if cursor == "" {
+		cursor = "0"
+	}
+	var args []interface{}
+	if it.key != "" {
+		args = append(args, it.key)
+	}
+	args = append(args, cursor)
+	match := it.opt.Match
+	if it.cmd == "SCAN" && it.instance.Config.Namespace != "" {
+		// only keys of the namespace are walked
+		if match == "" {
+			match = "*"
+		}
+		match = escapeGlob(it.instance.Config.Namespace) + match
+	}
+	if match != "" {
+		args = append(args, "MATCH", match)
+	}
+	args = append(args, "COUNT", it.opt.Count)
+	if it.cmd == "SCAN" && it.opt.Type != "" {
+		args = append(args, "TYPE", it.opt.Type)
+	}
+
+	var rdsConn redis.Conn
+	if len(it.nodes) > 0 {
+		rdsConn, it.err = getPooled(it.ctx, it.instance.cluster.pool(it.nodes[0]), it.instance.Config.PoolWaitTimeout, it.instance.waits)
+	} else {
+		rdsConn, it.err = it.instance.getConn(it.ctx)
+	}
+	if it.err != nil {
+		return
+	}
+	reply, err := redis.Values(it.instance.runOn(it.ctx, rdsConn, strings.ToLower(it.cmd), it.opt.DatadogAdditionalInfo, it.cmd, args...))
+	errRdsConn := rdsConn.Close()
+	if errRdsConn != nil {
+		it.err = errRdsConn
+		return
+	}
+	if err != nil {
+		it.err = err
+		return
+	}
+
+	// reply is [next cursor, [elements...]]
+	if len(reply) != 2 {
+		it.err = fmt.Errorf("[error][redis] unexpected %s reply", it.cmd)
+		return
+	}
+	if it.cursor, it.err = redis.String(reply[0], nil); it.err != nil {
+		return
+	}
+	it.buf, it.err = redis.Strings(reply[1], nil)
+	if it.cmd == "SCAN" {
+		for idx, key := range it.buf {
+			it.buf[idx] = it.instance.unprefixKey(key)
+		}
+	}
+}
+
+// Val return current key, member or field
+func (it *ScanIterator) Val() string {
+	return it.val
+}
+
+// Value return value of current field for HSCAN, or score of current member for ZSCAN
+func (it *ScanIterator) Value() string {
+	return it.value
+}
+
+// Err return error which stopped the iteration
+func (it *ScanIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,238 @@
+package connection
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+type (
+	// redisScripts is the script registry, shared by an instance and the instances derived with WithPrefix
+	redisScripts struct {
+		mu     sync.RWMutex
+		byName map[string]luaScript
+	}
+
+	luaScript struct {
+		name string
+		src  string
+		hash string
+	}
+
+	// ScriptReply hold raw reply of a script call, use the typed helpers to read it
+	ScriptReply struct {
+		reply interface{}
+		err   error
+	}
+)
+
+// newLuaScript hash src once, for scripts run directly such as the lock ones
+func newLuaScript(name, src string) luaScript {
+	h := sha1.New()
+	h.Write([]byte(src))
+	return luaScript{
+		name: name,
+		src:  src,
+		hash: hex.EncodeToString(h.Sum(nil)),
+	}
+}
+
+// RegisterScript register lua script under name, replacing any script registered with the same name
+func (i *RedisInstance) RegisterScript(name string, src string) {
+	if i.scripts == nil {
+		i.scripts = &redisScripts{}
+	}
+	i.scripts.mu.Lock()
+	if i.scripts.byName == nil {
+		i.scripts.byName = make(map[string]luaScript)
+	}
+	i.scripts.byName[name] = newLuaScript(name, src)
+	i.scripts.mu.Unlock()
+}
+
+// LoadScripts SCRIPT LOAD every registered script, useful on startup so the first call does not need EVAL.
+// In cluster mode scripts are loaded on every master
+func (i *RedisInstance) LoadScripts(ctx context.Context) (err error) {
+	if i.cluster == nil {
+		rdsConn, errConn := i.getConn(ctx)
+		if errConn != nil {
+			return errConn
+		}
+		return i.loadScriptsOn(ctx, rdsConn)
+	}
+
+	for _, node := range i.cluster.masters() {
+		rdsConn, errConn := getPooled(ctx, i.cluster.pool(node), i.Config.PoolWaitTimeout, i.waits)
+		if errConn == nil {
+			errConn = i.loadScriptsOn(ctx, rdsConn)
+		}
+		if errConn != nil {
+			return fmt.Errorf("[error][redis] Failed to load scripts on %s %s", node, errConn)
+		}
+	}
+	return
+}
+
+// loadScriptsOn SCRIPT LOAD every registered script on rdsConn, then close it
+func (i *RedisInstance) loadScriptsOn(ctx context.Context, rdsConn redis.Conn) (err error) {
+	if i.scripts != nil {
+		i.scripts.mu.RLock()
+		for name, script := range i.scripts.byName {
+			if _, err = i.runOn(ctx, rdsConn, "script_load", nil, "SCRIPT", "LOAD", script.src); err != nil {
+				err = fmt.Errorf("[error][redis] Failed to load script %s: %s", name, err)
+				break
+			}
+		}
+		i.scripts.mu.RUnlock()
+	}
+
+	errRdsConn := rdsConn.Close()
+	if errRdsConn != nil {
+		err = errRdsConn
+	}
+	return
+}
+
+// EvalScript is EvalScriptCtx without deadline
+func (i *RedisInstance) EvalScript(name string, keys []string, args []interface{}, datadogAdditionalInfo map[string]string) *ScriptReply {
+	return i.EvalScriptCtx(context.Background(), name, keys, args, datadogAdditionalInfo)
+}
+
+// EvalScriptCtx run registered script by EVALSHA. When redis does not know the script yet (NOSCRIPT),
+// it is sent again with EVAL which also put it in the server script cache
+func (i *RedisInstance) EvalScriptCtx(ctx context.Context, name string, keys []string, args []interface{}, datadogAdditionalInfo map[string]string) *ScriptReply {
+	var script luaScript
+	ok := false
+	if i.scripts != nil {
+		i.scripts.mu.RLock()
+		script, ok = i.scripts.byName[name]
+		i.scripts.mu.RUnlock()
+	}
+	if !ok {
+		return &ScriptReply{err: fmt.Errorf("[error][redis] script %s is not registered", name)}
+	}
+	return i.evalScript(ctx, script, keys, args, datadogAdditionalInfo)
+}
+
+// evalScript run script by EVALSHA, falling back to EVAL on NOSCRIPT
+func (i *RedisInstance) evalScript(ctx context.Context, script luaScript, keys []string, args []interface{}, datadogAdditionalInfo map[string]string) *ScriptReply {
+	var keysAndArgs []interface{}
+	keysAndArgs = append(keysAndArgs, script.hash, len(keys))
+	for _, k := range keys {
+		keysAndArgs = append(keysAndArgs, k)
+	}
+	keysAndArgs = append(keysAndArgs, args...)
+	keysAndArgs = i.prefixArgs("EVALSHA", keysAndArgs)
+
+	cmd := &RedisCmd{
+		Type: "evalsha",
+		Name: "EVALSHA",
+		Args: keysAndArgs,
+		Info: datadogAdditionalInfo,
+		Tags: []string{"script:" + script.name},
+	}
+	reply, err := i.process(ctx, cmd, func(ctx context.Context) (reply interface{}, err error) {
+		rdsConn, errConn := i.getConn(ctx)
+		if errConn != nil {
+			err = errConn
+
+			return
+		}
+		reply, err = doCtx(ctx, rdsConn, "EVALSHA", keysAndArgs...)
+		if errReply, ok := err.(redis.Error); ok && strings.HasPrefix(string(errReply), "NOSCRIPT") {
+			evalArgs := append([]interface{}{script.src}, keysAndArgs[1:]...)
+			reply, err = doCtx(ctx, rdsConn, "EVAL", evalArgs...)
+		}
+		errRdsConn := rdsConn.Close()
+		if errRdsConn != nil {
+			err = errRdsConn
+
+			return
+		}
+		return
+	})
+	if errReply, ok := err.(redis.Error); ok {
+		err = fmt.Errorf("[error][redis] script %s: %s", script.name, errReply)
+	}
+	return &ScriptReply{reply: reply, err: err}
+}
+
+// Err return error of the script call
+func (r *ScriptReply) Err() error {
+	return r.err
+}
+
+// Raw return reply as it is sent by redigo
+func (r *ScriptReply) Raw() (interface{}, error) {
+	return r.reply, r.err
+}
+
+// Int return integer reply, lua false and nil are read as 0
+func (r *ScriptReply) Int() (int, error) {
+	result, err := redis.Int(r.reply, r.err)
+	if err == redis.ErrNil {
+		return 0, nil
+	}
+	return result, err
+}
+
+// Int64 return integer reply, lua false and nil are read as 0
+func (r *ScriptReply) Int64() (int64, error) {
+	result, err := redis.Int64(r.reply, r.err)
+	if err == redis.ErrNil {
+		return 0, nil
+	}
+	return result, err
+}
+
+// Bool return reply as boolean, lua true is read as 1
+func (r *ScriptReply) Bool() (bool, error) {
+	result, err := redis.Bool(r.reply, r.err)
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	return result, err
+}
+
+// String return bulk or status reply, nil is read as empty string
+func (r *ScriptReply) String() (string, error) {
+	result, err := redis.String(r.reply, r.err)
+	if err == redis.ErrNil {
+		return "", nil
+	}
+	return result, err
+}
+
+// Float64 return reply as float, lua number is truncated to integer by redis so float is sent as string
+func (r *ScriptReply) Float64() (float64, error) {
+	result, err := redis.Float64(r.reply, r.err)
+	if err == redis.ErrNil {
+		return 0, nil
+	}
+	return result, err
+}
+
+// Strings return table reply as list of strings
+func (r *ScriptReply) Strings() ([]string, error) {
+	return redis.Strings(r.reply, r.err)
+}
+
+// Int64s return table reply as list of integers
+func (r *ScriptReply) Int64s() ([]int64, error) {
+	return redis.Int64s(r.reply, r.err)
+}
+
+// StringMap return table of alternating field and value as map
+func (r *ScriptReply) StringMap() (map[string]string, error) {
+	return redis.StringMap(r.reply, r.err)
+}
+
+// Values return table reply as is
+func (r *ScriptReply) Values() ([]interface{}, error) {
+	return redis.Values(r.reply, r.err)
+}
@@ -0,0 +1,63 @@
+package connection
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLoadScriptsEveryMaster(t *testing.T) {
+	var mu sync.Mutex
+	loads := make(map[string]int)
+	var addrs []string
+	node := func(name string) func(args []string) string {
+		return func(args []string) string {
+			switch strings.ToUpper(strings.Join(args[:2], " ")) {
+			case "CLUSTER SLOTS":
+				return clusterSlotsReply(addrs)
+			case "SCRIPT LOAD":
+				mu.Lock()
+				loads[name]++
+				mu.Unlock()
+				return "$40\r\n0000000000000000000000000000000000000000\r\n"
+			}
+			return "+OK\r\n"
+		}
+	}
+	addrs = []string{serveRESP(t, node("a")), serveRESP(t, node("b"))}
+
+	rds, err := NewRedisWithMetrics(RedisConfig{ClusterNodes: addrs[:1]}, nil)
+	if err != nil {
+		t.Fatalf("redis: %s", err)
+	}
+	defer rds.Close()
+	rds.RegisterScript("one", "return 1")
+	rds.RegisterScript("two", "return 2")
+
+	if err = rds.LoadScripts(context.Background()); err != nil {
+		t.Fatalf("load: %s", err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if loads[name] != 2 {
+			t.Errorf("node %s loaded %d scripts, want 2", name, loads[name])
+		}
+	}
+}
+
+// clusterSlotsReply split the slots evenly between addrs
+func clusterSlotsReply(addrs []string) string {
+	reply := fmt.Sprintf("*%d\r\n", len(addrs))
+	size := redisClusterSlots / len(addrs)
+	for idx, addr := range addrs {
+		host, port, _ := net.SplitHostPort(addr)
+		end := (idx+1)*size - 1
+		if idx == len(addrs)-1 {
+			end = redisClusterSlots - 1
+		}
+		reply += fmt.Sprintf("*3\r\n:%d\r\n:%d\r\n*2\r\n$%d\r\n%s\r\n:%s\r\n", idx*size, end, len(host), host, port)
+	}
+	return reply
+}
@@ -0,0 +1,321 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+const (
+	sentinelTimeout      = time.Second
+	sentinelPingInterval = 5 * time.Second
+)
+
+var (
+	// ErrRedisNotMaster is returned by the sentinel dialer when the resolved address is not a master anymore
+	ErrRedisNotMaster = errors.New("[error][redis] resolved address is not a master")
+
+	errRedisStaleConn = errors.New("[error][redis] connection made before master switch")
+)
+
+type (
+	// redisSentinel resolve master address from sentinels and invalidate pooled connections on failover
+	redisSentinel struct {
+		cfg RedisConfig
+
+		// generation is bumped when the master change, connections of older generation are dropped on borrow
+		// and idle ones are closed right away
+		generation uint64
+
+		mu        sync.Mutex
+		sentinels []string
+		closed    bool
+		psc       *redis.PubSubConn
+		stop      chan struct{}
+		// pools are the pools made by pool, their idle connections are closed on master switch
+		pools []*redis.Pool
+
+		// master is the address last resolved by the watcher, a change seen on reconnect is a missed switch
+		master string
+	}
+
+	// sentinelConn remember the generation it was dialed in
+	sentinelConn struct {
+		redis.Conn
+		generation uint64
+		sentinel   *redisSentinel
+	}
+)
+
+func newRedisSentinel(cfg RedisConfig) *redisSentinel {
+	return &redisSentinel{
+		cfg:       cfg,
+		sentinels: append([]string{}, cfg.SentinelAddrs...),
+		stop:      make(chan struct{}),
+	}
+}
+
+// Err report a connection dialed before the last master switch as broken, so the pool close it when it is
+// returned instead of keeping it idle
+func (c *sentinelConn) Err() error {
+	if c.sentinel != nil && c.generation != atomic.LoadUint64(&c.sentinel.generation) {
+		return errRedisStaleConn
+	}
+	return c.Conn.Err()
+}
+
+func (c *sentinelConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	return redis.DoWithTimeout(c.Conn, timeout, cmd, args...)
+}
+
+func (c *sentinelConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redis.ReceiveWithTimeout(c.Conn, timeout)
+}
+
+// dialSentinel connect to a sentinel with the TLS settings of the master and the sentinel credentials
+func (s *redisSentinel) dialSentinel(addr string) (redis.Conn, error) {
+	cfg := s.cfg
+	cfg.Username, cfg.Password, cfg.CredentialsFile = s.cfg.SentinelUsername, s.cfg.SentinelPassword, ""
+	cfg.DB, cfg.ClientName = 0, ""
+	cfg.DialTimeout, cfg.ReadTimeout, cfg.WriteTimeout = sentinelTimeout, sentinelTimeout, sentinelTimeout
+	return dialRedis(cfg, addr)
+}
+
+func (s *redisSentinel) getMasterAddr(c redis.Conn) (string, error) {
+	master, err := redis.Strings(c.Do("SENTINEL", "get-master-addr-by-name", s.cfg.SentinelMasterName))
+	if err != nil {
+		return "", err
+	}
+	if len(master) != 2 {
+		return "", fmt.Errorf("[error][redis] Unknown master %s", s.cfg.SentinelMasterName)
+	}
+	return net.JoinHostPort(master[0], master[1]), nil
+}
+
+// masterAddr ask sentinels in order for the current master, the sentinel that answer is moved to front
+func (s *redisSentinel) masterAddr() (addr string, err error) {
+	s.mu.Lock()
+	sentinels := append([]string{}, s.sentinels...)
+	s.mu.Unlock()
+
+	for idx, sentinelAddr := range sentinels {
+		c, errDial := s.dialSentinel(sentinelAddr)
+		if errDial != nil {
+			err = errDial
+			continue
+		}
+		master, errMaster := s.getMasterAddr(c)
+		c.Close()
+		if errMaster != nil {
+			err = errMaster
+			continue
+		}
+
+		if idx > 0 {
+			s.mu.Lock()
+			s.sentinels[0], s.sentinels[idx] = s.sentinels[idx], s.sentinels[0]
+			s.mu.Unlock()
+		}
+		return master, nil
+	}
+
+	return "", fmt.Errorf("[error][redis] Failed to resolve master %s from sentinel %s", s.cfg.SentinelMasterName, err)
+}
+
+// dial connect to the current master and make sure it still has master role
+func (s *redisSentinel) dial() (redis.Conn, error) {
+	generation := atomic.LoadUint64(&s.generation)
+
+	addr, err := s.masterAddr()
+	if err != nil {
+		return nil, err
+	}
+	c, err := dialRedis(s.cfg, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := redis.Values(c.Do("ROLE"))
+	if err == nil && len(role) > 0 {
+		var name string
+		name, err = redis.String(role[0], nil)
+		if err == nil && name != "master" {
+			err = ErrRedisNotMaster
+		}
+	}
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return &sentinelConn{
+		Conn:       c,
+		generation: generation,
+		sentinel:   s,
+	}, nil
+}
+
+func (s *redisSentinel) pool() (*redis.Pool, error) {
+	p, err := newPool(s.cfg, s.dial)
+	s.mu.Lock()
+	s.pools = append(s.pools, p)
+	s.mu.Unlock()
+	testOnBorrow := p.TestOnBorrow
+	p.TestOnBorrow = func(c redis.Conn, t time.Time) error {
+		if pc, ok := c.(*pooledConn); ok {
+			if sc, ok := pc.Conn.(*sentinelConn); ok && sc.generation != atomic.LoadUint64(&s.generation) {
+				return errRedisStaleConn
+			}
+		}
+		return testOnBorrow(c, t)
+	}
+	return p, err
+}
+
+// watch listen +switch-master on sentinels until Close, reconnecting to the next sentinel on error
+func (s *redisSentinel) watch() {
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+		sentinelAddr := ""
+		if len(s.sentinels) > 0 {
+			sentinelAddr = s.sentinels[0]
+			// next attempt goes to the next sentinel if this one fail
+			s.sentinels = append(s.sentinels[1:], sentinelAddr)
+		}
+		s.mu.Unlock()
+
+		if sentinelAddr != "" {
+			if err := s.listen(sentinelAddr); err != nil {
+				log.Println("[warning][redis] sentinel watcher", sentinelAddr, err)
+			}
+		}
+
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// listen subscribe +switch-master on one sentinel. A ping keep the connection checked, so a half-open
+// connection make the receive time out and the watcher move to the next sentinel
+func (s *redisSentinel) listen(sentinelAddr string) error {
+	c, err := s.dialSentinel(sentinelAddr)
+	if err != nil {
+		return err
+	}
+	psc := &redis.PubSubConn{Conn: c}
+	defer psc.Close()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.psc = psc
+	s.mu.Unlock()
+
+	// switch made while no sentinel was listened is caught by comparing the master with the last one seen
+	master, err := s.getMasterAddr(c)
+	if err != nil {
+		return err
+	}
+	s.switched(master)
+
+	if err = psc.Subscribe("+switch-master"); err != nil {
+		return err
+	}
+
+	pingDone := make(chan struct{})
+	defer close(pingDone)
+	go func() {
+		ticker := time.NewTicker(sentinelPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-pingDone:
+				return
+			case <-ticker.C:
+				if errPing := psc.Ping(""); errPing != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		switch v := psc.ReceiveWithTimeout(2 * sentinelPingInterval).(type) {
+		case redis.Message:
+			// payload is "<master name> <old ip> <old port> <new ip> <new port>"
+			fields := strings.Fields(string(v.Data))
+			if len(fields) == 5 && fields[0] == s.cfg.SentinelMasterName {
+				s.switched(net.JoinHostPort(fields[3], fields[4]))
+			}
+		case error:
+			return v
+		}
+	}
+}
+
+// switched record master as the current master. Idle connections to the previous one are closed, those in
+// use are dropped when returned and borrowed again
+func (s *redisSentinel) switched(master string) {
+	s.mu.Lock()
+	previous := s.master
+	s.master = master
+	pools := append([]*redis.Pool{}, s.pools...)
+	s.mu.Unlock()
+
+	if previous != "" && previous != master {
+		atomic.AddUint64(&s.generation, 1)
+		log.Printf("[info][redis] master %s switched to %s", s.cfg.SentinelMasterName, master)
+		for _, p := range pools {
+			closeIdle(p)
+		}
+	}
+}
+
+// closeIdle borrow every idle connection of p so TestOnBorrow close the stale ones, and give back the others
+func closeIdle(p *redis.Pool) {
+	ctx, cancel := context.WithTimeout(context.Background(), sentinelTimeout)
+	defer cancel()
+
+	var held []redis.Conn
+	for p.IdleCount() > 0 {
+		c, err := p.GetContext(ctx)
+		if err != nil {
+			break
+		}
+		held = append(held, c)
+	}
+	for _, c := range held {
+		c.Close()
+	}
+}
+
+// Close stop the watcher
+func (s *redisSentinel) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.stop)
+	if s.psc != nil {
+		s.psc.Close()
+	}
+}
@@ -0,0 +1,57 @@
+package connection
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestSentinelSwitchCloseOldConnections(t *testing.T) {
+	var addr string
+	addr = serveRESP(t, func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "SENTINEL":
+			host, port, _ := net.SplitHostPort(addr)
+			return fmt.Sprintf("*2\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(host), host, len(port), port)
+		case "ROLE":
+			return "*1\r\n$6\r\nmaster\r\n"
+		}
+		return "+OK\r\n"
+	})
+
+	s := newRedisSentinel(withRedisDefaults(RedisConfig{SentinelMasterName: "m", SentinelAddrs: []string{addr}}))
+	defer s.Close()
+	p, err := s.pool()
+	if err != nil {
+		t.Fatalf("pool: %s", err)
+	}
+	defer p.Close()
+	s.switched("10.0.0.1:6379")
+
+	var conns []interface{ Close() error }
+	for n := 0; n < 4; n++ {
+		c := p.Get()
+		if _, err = c.Do("PING"); err != nil {
+			t.Fatalf("ping: %s", err)
+		}
+		conns = append(conns, c)
+	}
+	inUse := conns[3]
+	for _, c := range conns[:3] {
+		c.Close()
+	}
+	if idle := p.IdleCount(); idle != 3 {
+		t.Fatalf("idle %d before switch, want 3", idle)
+	}
+
+	s.switched("10.0.0.2:6379")
+	// closeIdle may dial one connection to the new master while emptying the idle list
+	if active := p.ActiveCount(); active > 2 {
+		t.Fatalf("active %d after switch, want the one in use and at most one new", active)
+	}
+	inUse.Close()
+	if active := p.ActiveCount(); active > 1 {
+		t.Fatalf("active %d once the old connection is returned, want at most one new", active)
+	}
+}
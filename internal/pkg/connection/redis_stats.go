@@ -0,0 +1,130 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+type (
+	// RedisStats is the state of every pool of the instance: primary, replicas and cluster nodes
+	RedisStats struct {
+		// ActiveCount is connections in use or idle, IdleCount connections idle in the pools
+		ActiveCount int
+		IdleCount   int
+		// WaitCount is how many times a command waited for a free connection since NewRedis, and
+		// WaitDuration the total time spent waiting
+		WaitCount    int64
+		WaitDuration time.Duration
+	}
+
+	// poolWaits count waits for a free pooled connection
+	poolWaits struct {
+		count int64
+		nanos int64
+	}
+)
+
+func (w *poolWaits) observe(start time.Time) {
+	atomic.AddInt64(&w.count, 1)
+	atomic.AddInt64(&w.nanos, int64(time.Since(start)))
+}
+
+// Stats return pool statistics of the instance
+func (i *RedisInstance) Stats() (stats RedisStats) {
+	var pools []*redis.Pool
+	if i.RedisPool != nil {
+		pools = append(pools, i.RedisPool)
+	}
+	if i.replicas != nil {
+		for _, replica := range i.replicas.replicas {
+			pools = append(pools, replica.pool)
+		}
+	}
+	if i.cluster != nil {
+		i.cluster.mu.RLock()
+		for _, p := range i.cluster.pools {
+			pools = append(pools, p)
+		}
+		i.cluster.mu.RUnlock()
+	}
+
+	for _, p := range pools {
+		stats.ActiveCount += p.ActiveCount()
+		stats.IdleCount += p.IdleCount()
+	}
+	if i.waits != nil {
+		stats.WaitCount = atomic.LoadInt64(&i.waits.count)
+		stats.WaitDuration = time.Duration(atomic.LoadInt64(&i.waits.nanos))
+	}
+	return
+}
+
+// reportStats push Stats as gauges every interval until Close
+func (i *RedisInstance) reportStats(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-i.stop:
+			return
+		case <-ticker.C:
+		}
+		if i.metrics == nil {
+			continue
+		}
+
+		stats := i.Stats()
+		tags := []string{"ipredis:" + i.Config.Connection}
+		i.metrics.SetGauge("redis", "pool_active", float64(stats.ActiveCount), tags)
+		i.metrics.SetGauge("redis", "pool_idle", float64(stats.IdleCount), tags)
+		i.metrics.SetGauge("redis", "pool_wait_count", float64(stats.WaitCount), tags)
+		i.metrics.SetGauge("redis", "pool_wait_seconds", stats.WaitDuration.Seconds(), tags)
+	}
+}
+
+// Ping check redis answer PING within ctx, through the hooks so an open circuit breaker fail it. In cluster
+// mode every master is checked
+func (i *RedisInstance) Ping(ctx context.Context) (err error) {
+	if i.cluster == nil {
+		return checkPong(redis.String(i.run(ctx, "ping", nil, "PING")))
+	}
+
+	nodes := i.cluster.masters()
+	if len(nodes) <= 0 {
+		return errors.New("[error][redis] no cluster master known")
+	}
+	for _, node := range nodes {
+		if err = i.pingNode(ctx, node); err != nil {
+			return fmt.Errorf("[error][redis] Failed to PING %s %s", node, err)
+		}
+	}
+	return
+}
+
+// pingNode send PING to cluster node addr
+func (i *RedisInstance) pingNode(ctx context.Context, addr string) (err error) {
+	rdsConn, err := getPooled(ctx, i.cluster.pool(addr), i.Config.PoolWaitTimeout, i.waits)
+	if err != nil {
+		return
+	}
+	err = checkPong(redis.String(i.runOn(ctx, rdsConn, "ping", nil, "PING")))
+	if errRdsConn := rdsConn.Close(); err == nil {
+		err = errRdsConn
+	}
+	return
+}
+
+func checkPong(reply string, err error) error {
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("[error][redis] unexpected PING reply %s", reply)
+	}
+	return nil
+}
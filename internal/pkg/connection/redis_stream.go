@@ -0,0 +1,392 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+type (
+	// StreamMessage is one entry of a stream
+	StreamMessage struct {
+		ID     string
+		Values map[string]string
+	}
+
+	// StreamHandler process a message. Returning nil ACK the message, returning error leave it
+	// pending so it is claimed again after StreamConsumerConfig.MinIdle
+	StreamHandler func(ctx context.Context, msg StreamMessage) error
+
+	// StreamConsumerConfig configure a consumer group worker
+	StreamConsumerConfig struct {
+		Stream   string
+		Group    string
+		Consumer string
+		Handler  StreamHandler
+
+		// Concurrency is number of handler goroutines, default 1
+		Concurrency int
+		// Count is max messages fetched by one XREADGROUP or XAUTOCLAIM, default 10
+		Count int
+		// Block is how long XREADGROUP wait for new messages, default 5 second
+		Block time.Duration
+		// MinIdle is how long a message stay pending before another consumer can claim it, default 1 minute
+		MinIdle time.Duration
+		// ClaimInterval is how often pending messages of dead consumers are claimed, default MinIdle
+		ClaimInterval time.Duration
+		// MaxDeliveries move a message to DeadLetterStream once it has been delivered that many
+		// times without ACK. Zero disable dead lettering
+		MaxDeliveries int
+		// DeadLetterStream default to Stream + ":dead"
+		DeadLetterStream string
+
+		DatadogAdditionalInfo map[string]string
+	}
+
+	// StreamConsumer read a stream as a member of a consumer group until Close
+	StreamConsumer struct {
+		instance *RedisInstance
+		cfg      StreamConsumerConfig
+
+		messages chan StreamMessage
+		cancel   context.CancelFunc
+		wg       sync.WaitGroup
+	}
+)
+
+/*X Command*/
+func (i *RedisInstance) XAdd(stream string, maxLen int, values map[string]string, datadogAdditionalInfo map[string]string) (id string, err error) {
+	return i.XAddCtx(context.Background(), stream, maxLen, values, datadogAdditionalInfo)
+}
+
+// XAddCtx append entry to stream. When maxLen is positive the stream is trimmed to about
+// maxLen entries with MAXLEN ~, which let redis trim whole macro nodes only
+func (i *RedisInstance) XAddCtx(ctx context.Context, stream string, maxLen int, values map[string]string, datadogAdditionalInfo map[string]string) (id string, err error) {
+	var args []interface{}
+	args = append(args, stream)
+	if maxLen > 0 {
+		args = append(args, "MAXLEN", "~", maxLen)
+	}
+	args = append(args, "*")
+	for k, v := range values {
+		args = append(args, k, v)
+	}
+
+	return redis.String(i.run(ctx, "xadd", datadogAdditionalInfo, "XADD", args...))
+}
+
+func (i *RedisInstance) XAck(stream, group string, ids []string, datadogAdditionalInfo map[string]string) (result int, err error) {
+	return i.XAckCtx(context.Background(), stream, group, ids, datadogAdditionalInfo)
+}
+
+// XAckCtx is XAck bounded by ctx
+func (i *RedisInstance) XAckCtx(ctx context.Context, stream, group string, ids []string, datadogAdditionalInfo map[string]string) (result int, err error) {
+	if len(ids) <= 0 {
+		return
+	}
+	var args []interface{}
+	args = append(args, stream, group)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	return redis.Int(i.run(ctx, "xack", datadogAdditionalInfo, "XACK", args...))
+}
+
+// XGroupCreate create consumer group on stream starting at start ("$" for new messages only, "0" for
+// the whole stream). Stream is created when missing, and existing group is not an error
+func (i *RedisInstance) XGroupCreate(stream, group, start string) (err error) {
+	return i.XGroupCreateCtx(context.Background(), stream, group, start)
+}
+
+// XGroupCreateCtx is XGroupCreate bounded by ctx
+func (i *RedisInstance) XGroupCreateCtx(ctx context.Context, stream, group, start string) (err error) {
+	_, err = i.run(ctx, "xgroup", nil, "XGROUP", "CREATE", stream, group, start, "MKSTREAM")
+	if errReply, ok := err.(redis.Error); ok && strings.HasPrefix(string(errReply), "BUSYGROUP") {
+		err = nil
+	}
+	return
+}
+
+// parseStreamEntries read [[id, [field, value, ...]], ...]. Entry deleted while pending come as nil and is skipped
+func parseStreamEntries(reply interface{}, errReply error) (messages []StreamMessage, err error) {
+	entries, err := redis.Values(reply, errReply)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		entry, errEntry := redis.Values(e, nil)
+		if errEntry != nil || len(entry) < 2 {
+			continue
+		}
+		id, errID := redis.String(entry[0], nil)
+		if errID != nil {
+			continue
+		}
+		values, errValues := redis.StringMap(entry[1], nil)
+		if errValues != nil {
+			continue
+		}
+		messages = append(messages, StreamMessage{ID: id, Values: values})
+	}
+	return
+}
+
+// NewStreamConsumer create the consumer group if needed and start reading. Call Close to stop
+func (i *RedisInstance) NewStreamConsumer(cfg StreamConsumerConfig) (c *StreamConsumer, err error) {
+	if cfg.Stream == "" || cfg.Group == "" || cfg.Consumer == "" || cfg.Handler == nil {
+		return nil, errors.New("[error][redis] stream consumer need Stream, Group, Consumer and Handler")
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.Count <= 0 {
+		cfg.Count = 10
+	}
+	if cfg.Block <= 0 {
+		cfg.Block = 5 * time.Second
+	}
+	if cfg.MinIdle <= 0 {
+		cfg.MinIdle = time.Minute
+	}
+	if cfg.ClaimInterval <= 0 {
+		cfg.ClaimInterval = cfg.MinIdle
+	}
+	if cfg.DeadLetterStream == "" {
+		cfg.DeadLetterStream = cfg.Stream + ":dead"
+	}
+
+	if err = i.XGroupCreate(cfg.Stream, cfg.Group, "$"); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c = &StreamConsumer{
+		instance: i,
+		cfg:      cfg,
+		messages: make(chan StreamMessage),
+		cancel:   cancel,
+	}
+
+	for w := 0; w < cfg.Concurrency; w++ {
+		c.wg.Add(1)
+		go c.work(ctx)
+	}
+	c.wg.Add(2)
+	go c.read(ctx)
+	go c.claim(ctx)
+	return c, nil
+}
+
+// Close stop reading, wait for in flight handlers and return. Unacked messages stay pending
+func (c *StreamConsumer) Close() {
+	c.cancel()
+	c.wg.Wait()
+}
+
+func (c *StreamConsumer) dispatch(ctx context.Context, messages []StreamMessage) bool {
+	for _, msg := range messages {
+		select {
+		case c.messages <- msg:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+func (c *StreamConsumer) work(ctx context.Context) {
+	defer c.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-c.messages:
+			loggingStartTime := time.Now()
+			err := c.cfg.Handler(ctx, msg)
+			c.instance.histogram("xhandle", loggingStartTime, c.cfg.DatadogAdditionalInfo, "stream:"+c.cfg.Stream)
+			if err != nil {
+				log.Println("[warning][redis] stream", c.cfg.Stream, "message", msg.ID, err)
+				continue
+			}
+			if _, err = c.instance.XAckCtx(context.Background(), c.cfg.Stream, c.cfg.Group, []string{msg.ID}, c.cfg.DatadogAdditionalInfo); err != nil {
+				log.Println("[warning][redis] stream", c.cfg.Stream, "ack", msg.ID, err)
+			}
+		}
+	}
+}
+
+// read fetch new messages with XREADGROUP BLOCK
+func (c *StreamConsumer) read(ctx context.Context) {
+	defer c.wg.Done()
+	for ctx.Err() == nil {
+		messages, err := c.readGroup(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Println("[warning][redis] stream", c.cfg.Stream, "read", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		if !c.dispatch(ctx, messages) {
+			return
+		}
+	}
+}
+
+func (c *StreamConsumer) readGroup(ctx context.Context) (messages []StreamMessage, err error) {
+	// read timeout must outlive the server side block
+	readCtx, cancel := context.WithTimeout(ctx, c.cfg.Block+5*time.Second)
+	reply, err := redis.Values(c.instance.run(readCtx, "xreadgroup", c.cfg.DatadogAdditionalInfo, "XREADGROUP",
+		"GROUP", c.cfg.Group, c.cfg.Consumer,
+		"COUNT", c.cfg.Count,
+		"BLOCK", int64(c.cfg.Block/time.Millisecond),
+		"STREAMS", c.cfg.Stream, ">",
+	))
+	cancel()
+	if err == redis.ErrNil {
+		// block timed out without message
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// reply is [[stream, entries]]
+	for _, s := range reply {
+		stream, errStream := redis.Values(s, nil)
+		if errStream != nil || len(stream) < 2 {
+			continue
+		}
+		entries, errEntries := parseStreamEntries(stream[1], nil)
+		if errEntries != nil {
+			return nil, errEntries
+		}
+		messages = append(messages, entries...)
+	}
+	return
+}
+
+// claim periodically dead letter messages delivered too many times and take over messages
+// pending longer than MinIdle, which belong to consumers that died or failed
+func (c *StreamConsumer) claim(ctx context.Context) {
+	defer c.wg.Done()
+	ticker := time.NewTicker(c.cfg.ClaimInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if c.cfg.MaxDeliveries > 0 {
+			if err := c.deadLetter(ctx); err != nil && ctx.Err() == nil {
+				log.Println("[warning][redis] stream", c.cfg.Stream, "dead letter", err)
+			}
+		}
+
+		start := "0-0"
+		for {
+			messages, next, err := c.autoClaim(ctx, start)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Println("[warning][redis] stream", c.cfg.Stream, "claim", err)
+				}
+				break
+			}
+			if !c.dispatch(ctx, messages) {
+				return
+			}
+			if next == "0-0" || next == "" {
+				break
+			}
+			start = next
+		}
+	}
+}
+
+func (c *StreamConsumer) autoClaim(ctx context.Context, start string) (messages []StreamMessage, next string, err error) {
+	reply, err := redis.Values(c.instance.run(ctx, "xautoclaim", c.cfg.DatadogAdditionalInfo, "XAUTOCLAIM", c.cfg.Stream, c.cfg.Group, c.cfg.Consumer,
+		int64(c.cfg.MinIdle/time.Millisecond), start, "COUNT", c.cfg.Count))
+	if err != nil {
+		return nil, "", err
+	}
+
+	// reply is [next cursor, entries, deleted ids (redis 7)]
+	if len(reply) < 2 {
+		return nil, "", nil
+	}
+	next, err = redis.String(reply[0], nil)
+	if err != nil {
+		return nil, "", err
+	}
+	messages, err = parseStreamEntries(reply[1], nil)
+	return
+}
+
+// deadLetter move idle pending messages delivered at least MaxDeliveries times to DeadLetterStream. Every
+// command is routed by its own key, so in cluster mode the dead letter stream may live on another node.
+// Pending entries are read page by page, each page starting after the last id of the previous one
+func (c *StreamConsumer) deadLetter(ctx context.Context) (err error) {
+	// pending list and entries must be read on the primary, a replica may not have the last deliveries yet
+	ctx = WithPrimaryRead(ctx)
+
+	start := "-"
+	for {
+		// each pending entry is [id, consumer, idle ms, delivery count]
+		pending, errPending := redis.Values(c.instance.run(ctx, "xpending", c.cfg.DatadogAdditionalInfo, "XPENDING", c.cfg.Stream, c.cfg.Group,
+			"IDLE", int64(c.cfg.MinIdle/time.Millisecond), start, "+", c.cfg.Count))
+		if errPending != nil {
+			return errPending
+		}
+		for _, p := range pending {
+			entry, errEntry := redis.Values(p, nil)
+			if errEntry != nil || len(entry) < 4 {
+				continue
+			}
+			id, _ := redis.String(entry[0], nil)
+			start = "(" + id
+			deliveries, _ := redis.Int(entry[3], nil)
+			if deliveries < c.cfg.MaxDeliveries {
+				continue
+			}
+			if err = c.moveToDeadLetter(ctx, id); err != nil {
+				return err
+			}
+		}
+		if len(pending) < c.cfg.Count {
+			return nil
+		}
+	}
+}
+
+// moveToDeadLetter copy pending message id to DeadLetterStream then ACK it. Message deleted from the stream
+// is only ACKed
+func (c *StreamConsumer) moveToDeadLetter(ctx context.Context, id string) (err error) {
+	messages, err := parseStreamEntries(c.instance.run(ctx, "xrange", c.cfg.DatadogAdditionalInfo, "XRANGE", c.cfg.Stream, id, id))
+	if err != nil {
+		return err
+	}
+	if len(messages) > 0 {
+		args := []interface{}{c.cfg.DeadLetterStream, "*", "source_stream", c.cfg.Stream, "source_id", id}
+		for k, v := range messages[0].Values {
+			args = append(args, k, v)
+		}
+		if _, err = c.instance.run(ctx, "xadd", c.cfg.DatadogAdditionalInfo, "XADD", args...); err != nil {
+			return err
+		}
+	}
+	_, err = c.instance.run(ctx, "xack", c.cfg.DatadogAdditionalInfo, "XACK", c.cfg.Stream, c.cfg.Group, id)
+	return
+}
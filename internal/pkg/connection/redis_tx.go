@@ -0,0 +1,198 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ErrRedisTxAborted is returned when EXEC is discarded because a watched key changed
+var ErrRedisTxAborted = errors.New("[error][redis] transaction aborted, watched key changed")
+
+type (
+	// Tx is an optimistic transaction. Reads run right away on the watched connection,
+	// writes queued on Queue are sent inside MULTI/EXEC once the callback returns
+	Tx struct {
+		Queue *Pipeline
+
+		instance              *RedisInstance
+		ctx                   context.Context
+		conn                  redis.Conn
+		datadogAdditionalInfo map[string]string
+	}
+
+	// TxFunc read watched keys and queue writes. Returning error abort the transaction
+	TxFunc func(tx *Tx) error
+)
+
+// Watch is WatchCtx without deadline
+func (i *RedisInstance) Watch(fn TxFunc, datadogAdditionalInfo map[string]string, keys ...string) (err error) {
+	return i.WatchCtx(context.Background(), fn, datadogAdditionalInfo, keys...)
+}
+
+// WatchCtx WATCH keys, run fn and EXEC the queued writes. When a watched key is changed by another
+// client before EXEC, fn is run again up to Config.TxMaxRetries times before ErrRedisTxAborted is returned
+func (i *RedisInstance) WatchCtx(ctx context.Context, fn TxFunc, datadogAdditionalInfo map[string]string, keys ...string) (err error) {
+	maxRetries := i.Config.TxMaxRetries
+	switch {
+	case maxRetries == 0:
+		maxRetries = 3
+	case maxRetries < 0:
+		maxRetries = 0
+	}
+
+	cmd := &RedisCmd{Type: "tx", Info: datadogAdditionalInfo, pipeline: true}
+	_, err = i.process(ctx, cmd, func(ctx context.Context) (reply interface{}, err error) {
+		rdsConn, errConn := i.getConn(ctx)
+		if errConn != nil {
+			err = errConn
+
+			return
+		}
+
+		attempts := 0
+		for attempts <= maxRetries {
+			attempts++
+			err = i.runTx(ctx, rdsConn, cmd, fn, keys)
+			if err != ErrRedisTxAborted {
+				break
+			}
+		}
+		cmd.Tags = append(cmd.Tags, "attempts:"+strconv.Itoa(attempts))
+
+		errRdsConn := rdsConn.Close()
+		if errRdsConn != nil {
+			err = errRdsConn
+
+			return
+		}
+		return
+	})
+	return
+}
+
+// runTx run one attempt of the transaction, cmd.Cmds describe the commands sent by the last EXEC
+func (i *RedisInstance) runTx(ctx context.Context, rdsConn redis.Conn, cmd *RedisCmd, fn TxFunc, keys []string) (err error) {
+	if len(keys) > 0 {
+		var watchArgs []interface{}
+		for _, k := range keys {
+			watchArgs = append(watchArgs, k)
+		}
+		if _, err = doCtx(ctx, rdsConn, "WATCH", i.prefixArgs("WATCH", watchArgs)...); err != nil {
+			return
+		}
+	}
+
+	tx := &Tx{
+		Queue:                 i.Pipeline(),
+		instance:              i,
+		ctx:                   ctx,
+		conn:                  rdsConn,
+		datadogAdditionalInfo: cmd.Info,
+	}
+	if err = fn(tx); err != nil {
+		rdsConn.Do("UNWATCH")
+		return
+	}
+
+	cmds := tx.Queue.cmds
+	tx.Queue.cmds = nil
+	if len(cmds) <= 0 {
+		_, err = doCtx(ctx, rdsConn, "UNWATCH")
+		return
+	}
+	i.prefixCmds(cmds)
+	err = multiExec(ctx, rdsConn, cmds)
+	cmd.Cmds = hookCmds(cmds)
+	setHookReplies(cmd.Cmds, cmds)
+	return
+}
+
+// multiExec send cmds wrapped in MULTI/EXEC on rdsConn and fill their results. Returned error is
+// ErrRedisTxAborted when EXEC is discarded, otherwise the first connection or command error
+func multiExec(ctx context.Context, rdsConn redis.Conn, cmds []pipelined) (err error) {
+	defer func() {
+		for _, cmd := range cmds {
+			c := cmd.command()
+			if err != nil && c.err == nil {
+				c.err = err
+			}
+			cmd.decode()
+		}
+	}()
+
+	if err = rdsConn.Send("MULTI"); err != nil {
+		return
+	}
+	for _, cmd := range cmds {
+		c := cmd.command()
+		if err = rdsConn.Send(c.name, c.args...); err != nil {
+			return
+		}
+	}
+
+	var replies []interface{}
+	replies, err = redis.Values(doCtx(ctx, rdsConn, "EXEC"))
+	if err == redis.ErrNil {
+		err = ErrRedisTxAborted
+	}
+	if err != nil {
+		return
+	}
+
+	assignReplies(cmds, replies)
+	for _, cmd := range cmds {
+		if errCmd := cmd.command().err; errCmd != nil {
+			return errCmd
+		}
+	}
+	return
+}
+
+// do run a read inside the transaction, tagged the same way as the matching RedisInstance method
+func (tx *Tx) do(cmdType string, name string, args ...interface{}) (reply interface{}, err error) {
+	return tx.instance.runOn(tx.ctx, tx.conn, cmdType, tx.datadogAdditionalInfo, name, args...)
+}
+
+func (tx *Tx) Get(key string) (result string, err error) {
+	result, err = redis.String(tx.do("get", "GET", key))
+	if err == redis.ErrNil {
+		return "", nil
+	}
+	return
+}
+
+func (tx *Tx) HGet(key, field string) (result string, err error) {
+	result, err = redis.String(tx.do("hget", "HGET", key, field))
+	if err == redis.ErrNil {
+		return "", nil
+	}
+	return
+}
+
+func (tx *Tx) HGetAll(key string) (result map[string]string, err error) {
+	return redis.StringMap(tx.do("hgetall", "HGETALL", key))
+}
+
+func (tx *Tx) ZScore(key, member string) (result float64, err error) {
+	result, err = redis.Float64(tx.do("zscore", "ZSCORE", key, member))
+	if err == redis.ErrNil {
+		return 0, nil
+	}
+	return
+}
+
+func (tx *Tx) SMembers(key string) (result []string, err error) {
+	return redis.Strings(tx.do("smembers", "SMEMBERS", key))
+}
+
+func (tx *Tx) LRange(key string, startIndex int, endIndex int) (result []string, err error) {
+	return redis.Strings(tx.do("lrange", "LRANGE", key, startIndex, endIndex))
+}
+
+func (tx *Tx) IsExist(key string) (bool, error) {
+	results, err := redis.Int64(tx.do("exists", "EXISTS", key))
+	return results > 0, err
+}
@@ -0,0 +1,409 @@
+package redistest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/loui58/odin/internal/pkg/connection"
+)
+
+// NewClientFunc return the client under test and a function moving its clock forward by d.
+// A real client should point at a dedicated DB or be derived with WithPrefix, and advance with time.Sleep
+type NewClientFunc func(t *testing.T) (client connection.RedisClient, advance func(d time.Duration))
+
+// Conformance run every command of connection.RedisClient against the client from newClient, so the fake
+// and RedisInstance are held to the same behaviour. Each subtest use its own keys and delete them first
+func Conformance(t *testing.T, newClient NewClientFunc) {
+	for _, tc := range conformanceCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			client, advance := newClient(t)
+			key := fmt.Sprintf("redistest:%s:%d", tc.name, time.Now().UnixNano())
+			for _, k := range []string{key, key + ":other"} {
+				if err := client.Delete(k, nil); err != nil {
+					t.Fatalf("delete %s: %s", k, err)
+				}
+			}
+			tc.run(t, client, advance, key)
+		})
+	}
+}
+
+type conformanceCase struct {
+	name string
+	run  func(t *testing.T, c connection.RedisClient, advance func(time.Duration), key string)
+}
+
+var conformanceCases = []conformanceCase{
+	{"string", testString},
+	{"expire", testExpire},
+	{"rename", testRename},
+	{"hash", testHash},
+	{"zset", testZSet},
+	{"zset_score", testZSetScore},
+	{"set", testSet},
+	{"list", testList},
+	{"list_rem_trim", testListRemTrim},
+	{"push_expire", testPushExpire},
+	{"wrong_type", testWrongType},
+	{"context", testContext},
+}
+
+func check(t *testing.T, what string, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", what, err)
+	}
+}
+
+func equal(t *testing.T, what string, got, want interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("%s: got %#v, want %#v", what, got, want)
+	}
+}
+
+func sorted(s []string) []string {
+	sort.Strings(s)
+	return s
+}
+
+func testString(t *testing.T, c connection.RedisClient, advance func(time.Duration), key string) {
+	v, err := c.Get(key, nil)
+	check(t, "get missing", err)
+	equal(t, "get missing", v, "")
+
+	exist, err := c.IsExist(key, nil)
+	check(t, "exists missing", err)
+	equal(t, "exists missing", exist, false)
+
+	check(t, "set", c.Set(key, "a", 0, nil))
+	check(t, "set again", c.Set(key, "b", 0, nil))
+	v, err = c.Get(key, nil)
+	check(t, "get", err)
+	equal(t, "get", v, "b")
+
+	exist, err = c.IsExist(key, nil)
+	check(t, "exists", err)
+	equal(t, "exists", exist, true)
+
+	check(t, "delete", c.Delete(key, nil))
+	exist, err = c.IsExist(key, nil)
+	check(t, "exists deleted", err)
+	equal(t, "exists deleted", exist, false)
+
+	_, found, err := c.GetBytes(key, nil)
+	check(t, "getbytes missing", err)
+	equal(t, "getbytes missing", found, false)
+	check(t, "set empty", c.Set(key, "", 0, nil))
+	data, found, err := c.GetBytes(key, nil)
+	check(t, "getbytes empty", err)
+	equal(t, "getbytes empty found", found, true)
+	equal(t, "getbytes empty", len(data), 0)
+}
+
+func testExpire(t *testing.T, c connection.RedisClient, advance func(time.Duration), key string) {
+	check(t, "set", c.Set(key, "a", 1, nil))
+	advance(2 * time.Second)
+	exist, err := c.IsExist(key, nil)
+	check(t, "exists expired", err)
+	equal(t, "exists expired", exist, false)
+
+	n, err := c.Expire(key, 10, nil)
+	check(t, "expire missing", err)
+	equal(t, "expire missing", n, 0)
+
+	check(t, "set", c.Set(key, "a", 0, nil))
+	n, err = c.Expire(key, 1, nil)
+	check(t, "expire", err)
+	equal(t, "expire", n, 1)
+	advance(2 * time.Second)
+	v, err := c.Get(key, nil)
+	check(t, "get expired", err)
+	equal(t, "get expired", v, "")
+
+	check(t, "set", c.Set(key, "a", 0, nil))
+	n, err = c.Expire(key, 0, nil)
+	check(t, "expire zero", err)
+	equal(t, "expire zero", n, 1)
+	exist, err = c.IsExist(key, nil)
+	check(t, "exists after expire zero", err)
+	equal(t, "exists after expire zero", exist, false)
+}
+
+func testRename(t *testing.T, c connection.RedisClient, advance func(time.Duration), key string) {
+	other := key + ":other"
+	if err := c.Rename(key, other); err == nil {
+		t.Fatalf("rename missing: want error")
+	}
+
+	check(t, "set", c.Set(key, "a", 0, nil))
+	check(t, "rename", c.Rename(key, other))
+	v, err := c.Get(other, nil)
+	check(t, "get renamed", err)
+	equal(t, "get renamed", v, "a")
+	exist, err := c.IsExist(key, nil)
+	check(t, "exists old", err)
+	equal(t, "exists old", exist, false)
+	check(t, "delete renamed", c.Delete(other, nil))
+}
+
+func testHash(t *testing.T, c connection.RedisClient, advance func(time.Duration), key string) {
+	all, err := c.HGetAll(key, nil)
+	check(t, "hgetall missing", err)
+	equal(t, "hgetall missing", all, map[string]string{})
+
+	v, err := c.HGet(key, "f", nil)
+	check(t, "hget missing", err)
+	equal(t, "hget missing", v, "")
+
+	check(t, "hset", c.HSet(key, "a", "1", nil))
+	check(t, "hmset", c.HMSet(key, map[string]string{"b": "2", "c": "3"}, nil))
+
+	v, err = c.HGet(key, "b", nil)
+	check(t, "hget", err)
+	equal(t, "hget", v, "2")
+
+	n, err := c.HLen(key, nil)
+	check(t, "hlen", err)
+	equal(t, "hlen", n, 3)
+
+	got, err := c.HMGet(key, []string{"a", "c", "z"}, nil)
+	check(t, "hmget", err)
+	equal(t, "hmget", got, map[string]string{"a": "1", "c": "3", "z": ""})
+
+	if err = c.HDel(key, nil, nil); err == nil {
+		t.Fatalf("hdel without members: want error")
+	}
+	check(t, "hdel", c.HDel(key, []string{"a", "b"}, nil))
+	all, err = c.HGetAll(key, nil)
+	check(t, "hgetall", err)
+	equal(t, "hgetall", all, map[string]string{"c": "3"})
+
+	check(t, "hdel last", c.HDel(key, []string{"c"}, nil))
+	exist, err := c.IsExist(key, nil)
+	check(t, "exists emptied", err)
+	equal(t, "exists emptied", exist, false)
+}
+
+func testZSet(t *testing.T, c connection.RedisClient, advance func(time.Duration), key string) {
+	members, err := c.ZRange(key, 0, -1, nil)
+	check(t, "zrange missing", err)
+	equal(t, "zrange missing", members, []string{})
+
+	n, err := c.ZAdd(key, map[string]float64{"a": 1, "b": 2, "c": 3}, nil)
+	check(t, "zadd", err)
+	equal(t, "zadd", n, 3)
+	n, err = c.ZAdd(key, map[string]float64{"c": 4, "d": 5}, nil)
+	check(t, "zadd update", err)
+	equal(t, "zadd update", n, 1)
+
+	members, err = c.ZRange(key, 0, -1, nil)
+	check(t, "zrange", err)
+	equal(t, "zrange", members, []string{"a", "b", "c", "d"})
+
+	members, err = c.ZRange(key, 1, 2, nil)
+	check(t, "zrange slice", err)
+	equal(t, "zrange slice", members, []string{"b", "c"})
+
+	members, err = c.ZRevRange(key, 0, 1, nil)
+	check(t, "zrevrange", err)
+	equal(t, "zrevrange", members, []string{"d", "c"})
+
+	members, err = c.ZRange(key, -2, -1, nil)
+	check(t, "zrange negative", err)
+	equal(t, "zrange negative", members, []string{"c", "d"})
+
+	scores, err := c.ZRangeWithscores(key, 0, 1, nil)
+	check(t, "zrange withscores", err)
+	equal(t, "zrange withscores", scores, map[string]float64{"a": 1, "b": 2})
+
+	scores, err = c.ZRevRangeWithscores(key, 0, 0, nil)
+	check(t, "zrevrange withscores", err)
+	equal(t, "zrevrange withscores", scores, map[string]float64{"d": 5})
+
+	if err = c.ZRem(key, nil, nil); err == nil {
+		t.Fatalf("zrem without members: want error")
+	}
+	check(t, "zrem", c.ZRem(key, []string{"a", "d", "z"}, nil))
+	members, err = c.ZRange(key, 0, -1, nil)
+	check(t, "zrange after zrem", err)
+	equal(t, "zrange after zrem", members, []string{"b", "c"})
+
+	check(t, "zrem last", c.ZRem(key, []string{"b", "c"}, nil))
+	exist, err := c.IsExist(key, nil)
+	check(t, "exists emptied", err)
+	equal(t, "exists emptied", exist, false)
+}
+
+func testZSetScore(t *testing.T, c connection.RedisClient, advance func(time.Duration), key string) {
+	score, err := c.ZScore(key, "a", nil)
+	check(t, "zscore missing", err)
+	equal(t, "zscore missing", score, float64(0))
+
+	_, err = c.ZAdd(key, map[string]float64{"a": 1, "b": 2, "c": 3, "d": 4}, nil)
+	check(t, "zadd", err)
+	check(t, "zincrby", c.ZIncrBy(key, 1.5, "a", nil))
+	check(t, "zincrby new", c.ZIncrBy(key, 0.5, "e", nil))
+
+	score, err = c.ZScore(key, "a", nil)
+	check(t, "zscore", err)
+	equal(t, "zscore", score, 2.5)
+
+	members, err := c.ZRangeByScore(key, "2", "3", nil)
+	check(t, "zrangebyscore", err)
+	equal(t, "zrangebyscore", members, []string{"b", "a", "c"})
+
+	members, err = c.ZRangeByScore(key, "(2", "+inf", nil)
+	check(t, "zrangebyscore exclusive", err)
+	equal(t, "zrangebyscore exclusive", members, []string{"a", "c", "d"})
+
+	members, err = c.ZRevRangeByScore(key, "(4", "-inf", nil)
+	check(t, "zrevrangebyscore", err)
+	equal(t, "zrevrangebyscore", members, []string{"c", "a", "b", "e"})
+
+	n, err := c.ZCount(key, "-inf", "+inf", nil)
+	check(t, "zcount", err)
+	equal(t, "zcount", n, 5)
+
+	n, err = c.ZCount(key, "(1", "(4", nil)
+	check(t, "zcount exclusive", err)
+	equal(t, "zcount exclusive", n, 3)
+
+	if _, err = c.ZCount(key, "x", "1", nil); err == nil {
+		t.Fatalf("zcount bad bound: want error")
+	}
+}
+
+func testSet(t *testing.T, c connection.RedisClient, advance func(time.Duration), key string) {
+	members, err := c.SMembers(key, nil)
+	check(t, "smembers missing", err)
+	equal(t, "smembers missing", members, []string{})
+
+	check(t, "sadd empty", c.SAdd(key, nil, 0, nil))
+	exist, err := c.IsExist(key, nil)
+	check(t, "exists after empty sadd", err)
+	equal(t, "exists after empty sadd", exist, false)
+
+	check(t, "sadd", c.SAdd(key, []string{"a", "b"}, 0, nil))
+	check(t, "sadd again", c.SAdd(key, []string{"b", "c"}, 0, nil))
+	members, err = c.SMembers(key, nil)
+	check(t, "smembers", err)
+	equal(t, "smembers", sorted(members), []string{"a", "b", "c"})
+}
+
+func testList(t *testing.T, c connection.RedisClient, advance func(time.Duration), key string) {
+	items, err := c.LRange(key, 0, -1, nil)
+	check(t, "lrange missing", err)
+	equal(t, "lrange missing", items, []string{})
+
+	check(t, "rpush", c.RPush(key, []string{"b", "c"}, 0, nil))
+	check(t, "lpush", c.LPush(key, []string{"a", "z"}, 0, nil))
+	items, err = c.LRange(key, 0, -1, nil)
+	check(t, "lrange", err)
+	equal(t, "lrange", items, []string{"z", "a", "b", "c"})
+
+	items, err = c.LRange(key, 1, 2, nil)
+	check(t, "lrange slice", err)
+	equal(t, "lrange slice", items, []string{"a", "b"})
+
+	items, err = c.LRange(key, -2, 10, nil)
+	check(t, "lrange negative", err)
+	equal(t, "lrange negative", items, []string{"b", "c"})
+
+	items, err = c.LRange(key, 5, 10, nil)
+	check(t, "lrange out of range", err)
+	equal(t, "lrange out of range", items, []string{})
+}
+
+func testListRemTrim(t *testing.T, c connection.RedisClient, advance func(time.Duration), key string) {
+	check(t, "rpush", c.RPush(key, []string{"x", "a", "x", "b", "x", "c", "x"}, 0, nil))
+
+	check(t, "lrem head", c.LRem(key, 1, "x", nil))
+	items, err := c.LRange(key, 0, -1, nil)
+	check(t, "lrange", err)
+	equal(t, "lrem head", items, []string{"a", "x", "b", "x", "c", "x"})
+
+	check(t, "lrem tail", c.LRem(key, -2, "x", nil))
+	items, err = c.LRange(key, 0, -1, nil)
+	check(t, "lrange", err)
+	equal(t, "lrem tail", items, []string{"a", "x", "b", "c"})
+
+	check(t, "lrem all", c.LRem(key, 0, "x", nil))
+	items, err = c.LRange(key, 0, -1, nil)
+	check(t, "lrange", err)
+	equal(t, "lrem all", items, []string{"a", "b", "c"})
+
+	check(t, "ltrim", c.LTrim(key, 1, -1, nil))
+	items, err = c.LRange(key, 0, -1, nil)
+	check(t, "lrange", err)
+	equal(t, "ltrim", items, []string{"b", "c"})
+
+	check(t, "ltrim empty", c.LTrim(key, 5, 10, nil))
+	exist, err := c.IsExist(key, nil)
+	check(t, "exists emptied", err)
+	equal(t, "exists emptied", exist, false)
+}
+
+func testPushExpire(t *testing.T, c connection.RedisClient, advance func(time.Duration), key string) {
+	other := key + ":other"
+	check(t, "rpush", c.RPush(key, []string{"a"}, 1, nil))
+	check(t, "sadd", c.SAdd(other, []string{"a"}, 1, nil))
+	advance(2 * time.Second)
+	for _, k := range []string{key, other} {
+		exist, err := c.IsExist(k, nil)
+		check(t, "exists expired", err)
+		equal(t, "exists expired "+k, exist, false)
+	}
+}
+
+func testWrongType(t *testing.T, c connection.RedisClient, advance func(time.Duration), key string) {
+	check(t, "set", c.Set(key, "a", 0, nil))
+	if _, err := c.HGet(key, "f", nil); err == nil {
+		t.Fatalf("hget on string: want error")
+	}
+	if _, err := c.ZAdd(key, map[string]float64{"a": 1}, nil); err == nil {
+		t.Fatalf("zadd on string: want error")
+	}
+	if err := c.RPush(key, []string{"a"}, 0, nil); err == nil {
+		t.Fatalf("rpush on string: want error")
+	}
+	if _, err := c.SMembers(key, nil); err == nil {
+		t.Fatalf("smembers on string: want error")
+	}
+
+	// SET overwrite whatever type the key held
+	check(t, "delete", c.Delete(key, nil))
+	check(t, "hset", c.HSet(key, "f", "v", nil))
+	if _, err := c.Get(key, nil); err == nil {
+		t.Fatalf("get on hash: want error")
+	}
+	check(t, "set over hash", c.Set(key, "a", 0, nil))
+	v, err := c.Get(key, nil)
+	check(t, "get", err)
+	equal(t, "get", v, "a")
+}
+
+func testContext(t *testing.T, c connection.RedisClient, advance func(time.Duration), key string) {
+	check(t, "ping", c.Ping(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.SetCtx(ctx, key, "a", 0, nil); err != connection.ErrRedisCanceled {
+		t.Fatalf("set canceled: got %v, want %v", err, connection.ErrRedisCanceled)
+	}
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if _, err := c.GetCtx(ctx, key, nil); err != connection.ErrRedisDeadlineExceeded {
+		t.Fatalf("get past deadline: got %v, want %v", err, connection.ErrRedisDeadlineExceeded)
+	}
+
+	exist, err := c.IsExist(key, nil)
+	check(t, "exists", err)
+	equal(t, "exists after canceled set", exist, false)
+}
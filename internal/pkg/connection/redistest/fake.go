@@ -0,0 +1,918 @@
+package redistest
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/loui58/odin/internal/pkg/connection"
+)
+
+const (
+	kindString = "string"
+	kindHash   = "hash"
+	kindSet    = "set"
+	kindList   = "list"
+	kindZSet   = "zset"
+)
+
+var (
+	errWrongType   = redis.Error("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errNoSuchKey   = redis.Error("ERR no such key")
+	errNotFloat    = redis.Error("ERR min or max is not a float")
+	errEmptyFields = redis.Error("ERR wrong number of arguments")
+)
+
+var _ connection.RedisClient = (*Fake)(nil)
+
+// NewFake create empty fake whose clock start at the current time
+func NewFake() *Fake {
+	return &Fake{
+		now:  time.Now(),
+		keys: make(map[string]*entry),
+	}
+}
+
+// Advance move the fake clock forward by d, keys whose ttl is reached are gone
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	f.now = f.now.Add(d)
+	f.mu.Unlock()
+}
+
+// Now return the fake clock
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// TTL return remaining time to live of key, -1 without ttl and -2 when key does not exist, like redis
+func (f *Fake) TTL(key string) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := f.lookup(key)
+	switch {
+	case e == nil:
+		return -2
+	case e.expires.IsZero():
+		return -1
+	}
+	return e.expires.Sub(f.now)
+}
+
+// Published return every message published on channel, oldest first
+func (f *Fake) Published(channel string) (messages []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, m := range f.published {
+		if m.Channel == channel {
+			messages = append(messages, m.Message)
+		}
+	}
+	return
+}
+
+// FlushAll drop every key and published message
+func (f *Fake) FlushAll() {
+	f.mu.Lock()
+	f.keys = make(map[string]*entry)
+	f.published = nil
+	f.mu.Unlock()
+}
+
+// ctxErr translate context error the way RedisInstance does
+func ctxErr(ctx context.Context) error {
+	switch ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return connection.ErrRedisDeadlineExceeded
+	default:
+		return connection.ErrRedisCanceled
+	}
+}
+
+// lookup return live entry of key, dropping it when expired. Caller must hold mu
+func (f *Fake) lookup(key string) *entry {
+	e, ok := f.keys[key]
+	if !ok {
+		return nil
+	}
+	if !e.expires.IsZero() && !f.now.Before(e.expires) {
+		delete(f.keys, key)
+		return nil
+	}
+	return e
+}
+
+// get return entry of key when it hold kind, nil when key does not exist. Caller must hold mu
+func (f *Fake) get(key, kind string) (*entry, error) {
+	e := f.lookup(key)
+	if e == nil {
+		return nil, nil
+	}
+	if e.kind != kind {
+		return nil, errWrongType
+	}
+	return e, nil
+}
+
+// getOrCreate return entry of key, created empty of kind when key does not exist. Caller must hold mu
+func (f *Fake) getOrCreate(key, kind string) (*entry, error) {
+	e, err := f.get(key, kind)
+	if err != nil || e != nil {
+		return e, err
+	}
+	e = &entry{kind: kind}
+	switch kind {
+	case kindHash:
+		e.hash = make(map[string]string)
+	case kindSet:
+		e.set = make(map[string]bool)
+	case kindZSet:
+		e.zset = make(map[string]float64)
+	}
+	f.keys[key] = e
+	return e, nil
+}
+
+// dropEmpty delete key once its collection is empty, like redis. Caller must hold mu
+func (f *Fake) dropEmpty(key string, e *entry) {
+	if len(e.hash) <= 0 && len(e.set) <= 0 && len(e.list) <= 0 && len(e.zset) <= 0 && e.kind != kindString {
+		delete(f.keys, key)
+	}
+}
+
+// expire set ttl of key, a non positive ttl delete it. Caller must hold mu
+func (f *Fake) expire(key string, seconds int) int {
+	e := f.lookup(key)
+	if e == nil {
+		return 0
+	}
+	if seconds <= 0 {
+		delete(f.keys, key)
+		return 1
+	}
+	e.expires = f.now.Add(time.Duration(seconds) * time.Second)
+	return 1
+}
+
+/*H Command*/
+func (f *Fake) HGetAll(key string, datadogAdditionalInfo map[string]string) (result map[string]string, err error) {
+	return f.HGetAllCtx(context.Background(), key, datadogAdditionalInfo)
+}
+
+func (f *Fake) HGetAllCtx(ctx context.Context, key string, datadogAdditionalInfo map[string]string) (result map[string]string, err error) {
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, err := f.get(key, kindHash)
+	if err != nil {
+		return
+	}
+	result = make(map[string]string)
+	if e != nil {
+		for k, v := range e.hash {
+			result[k] = v
+		}
+	}
+	return
+}
+
+func (f *Fake) HLen(key string, datadogAdditionalInfo map[string]string) (result int, err error) {
+	return f.HLenCtx(context.Background(), key, datadogAdditionalInfo)
+}
+
+func (f *Fake) HLenCtx(ctx context.Context, key string, datadogAdditionalInfo map[string]string) (result int, err error) {
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, err := f.get(key, kindHash)
+	if err != nil || e == nil {
+		return
+	}
+	return len(e.hash), nil
+}
+
+func (f *Fake) HGet(key, field string, datadogAdditionalInfo map[string]string) (result string, err error) {
+	return f.HGetCtx(context.Background(), key, field, datadogAdditionalInfo)
+}
+
+func (f *Fake) HGetCtx(ctx context.Context, key, field string, datadogAdditionalInfo map[string]string) (result string, err error) {
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, err := f.get(key, kindHash)
+	if err != nil || e == nil {
+		return
+	}
+	return e.hash[field], nil
+}
+
+func (f *Fake) HSet(key, field string, value string, datadogAdditionalInfo map[string]string) (err error) {
+	return f.HSetCtx(context.Background(), key, field, value, datadogAdditionalInfo)
+}
+
+func (f *Fake) HSetCtx(ctx context.Context, key, field string, value string, datadogAdditionalInfo map[string]string) (err error) {
+	return f.HMSetCtx(ctx, key, map[string]string{field: value}, datadogAdditionalInfo)
+}
+
+func (f *Fake) HMGet(key string, fields []string, datadogAdditionalInfo map[string]string) (result map[string]string, err error) {
+	return f.HMGetCtx(context.Background(), key, fields, datadogAdditionalInfo)
+}
+
+func (f *Fake) HMGetCtx(ctx context.Context, key string, fields []string, datadogAdditionalInfo map[string]string) (result map[string]string, err error) {
+	result = make(map[string]string)
+	if len(fields) <= 0 {
+		return
+	}
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, err := f.get(key, kindHash)
+	if err != nil {
+		return
+	}
+	for _, field := range fields {
+		result[field] = ""
+		if e != nil {
+			result[field] = e.hash[field]
+		}
+	}
+	return
+}
+
+func (f *Fake) HMSet(key string, pairs map[string]string, datadogAdditionalInfo map[string]string) (err error) {
+	return f.HMSetCtx(context.Background(), key, pairs, datadogAdditionalInfo)
+}
+
+func (f *Fake) HMSetCtx(ctx context.Context, key string, pairs map[string]string, datadogAdditionalInfo map[string]string) (err error) {
+	if len(pairs) <= 0 {
+		return
+	}
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, err := f.getOrCreate(key, kindHash)
+	if err != nil {
+		return
+	}
+	for k, v := range pairs {
+		e.hash[k] = v
+	}
+	return
+}
+
+func (f *Fake) HDel(key string, members []string, datadogAdditionalInfo map[string]string) (err error) {
+	return f.HDelCtx(context.Background(), key, members, datadogAdditionalInfo)
+}
+
+func (f *Fake) HDelCtx(ctx context.Context, key string, members []string, datadogAdditionalInfo map[string]string) (err error) {
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	if len(members) <= 0 {
+		return errEmptyFields
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, err := f.get(key, kindHash)
+	if err != nil || e == nil {
+		return
+	}
+	for _, m := range members {
+		delete(e.hash, m)
+	}
+	f.dropEmpty(key, e)
+	return
+}
+
+/*Z Command*/
+func (f *Fake) ZScore(key, member string, datadogAdditionalInfo map[string]string) (result float64, err error) {
+	return f.ZScoreCtx(context.Background(), key, member, datadogAdditionalInfo)
+}
+
+func (f *Fake) ZScoreCtx(ctx context.Context, key, member string, datadogAdditionalInfo map[string]string) (result float64, err error) {
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, err := f.get(key, kindZSet)
+	if err != nil || e == nil {
+		return
+	}
+	return e.zset[member], nil
+}
+
+func (f *Fake) ZAdd(key string, pairs map[string]float64, datadogAdditionalInfo map[string]string) (result int, err error) {
+	return f.ZAddCtx(context.Background(), key, pairs, datadogAdditionalInfo)
+}
+
+func (f *Fake) ZAddCtx(ctx context.Context, key string, pairs map[string]float64, datadogAdditionalInfo map[string]string) (result int, err error) {
+	if len(pairs) <= 0 {
+		return
+	}
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, err := f.getOrCreate(key, kindZSet)
+	if err != nil {
+		return
+	}
+	for member, score := range pairs {
+		if _, ok := e.zset[member]; !ok {
+			result++
+		}
+		e.zset[member] = score
+	}
+	return
+}
+
+func (f *Fake) ZIncrBy(key string, increment float64, member string, datadogAdditionalInfo map[string]string) (err error) {
+	return f.ZIncrByCtx(context.Background(), key, increment, member, datadogAdditionalInfo)
+}
+
+func (f *Fake) ZIncrByCtx(ctx context.Context, key string, increment float64, member string, datadogAdditionalInfo map[string]string) (err error) {
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, err := f.getOrCreate(key, kindZSet)
+	if err != nil {
+		return
+	}
+	e.zset[member] += increment
+	return
+}
+
+func (f *Fake) ZRevRangeByScore(key, max, min string, datadogAdditionalInfo map[string]string) (result []string, err error) {
+	return f.ZRevRangeByScoreCtx(context.Background(), key, max, min, datadogAdditionalInfo)
+}
+
+func (f *Fake) ZRevRangeByScoreCtx(ctx context.Context, key, max, min string, datadogAdditionalInfo map[string]string) (result []string, err error) {
+	members, err := f.zrangeByScore(ctx, key, min, max)
+	if err != nil {
+		return
+	}
+	result = make([]string, 0, len(members))
+	for idx := len(members) - 1; idx >= 0; idx-- {
+		result = append(result, members[idx].member)
+	}
+	return
+}
+
+func (f *Fake) ZRevRange(key string, start, stop int, datadogAdditionalInfo map[string]string) (result []string, err error) {
+	return f.ZRevRangeCtx(context.Background(), key, start, stop, datadogAdditionalInfo)
+}
+
+func (f *Fake) ZRevRangeCtx(ctx context.Context, key string, start, stop int, datadogAdditionalInfo map[string]string) (result []string, err error) {
+	members, err := f.zrange(ctx, key, start, stop, true)
+	return memberNames(members), err
+}
+
+func (f *Fake) ZRevRangeWithscores(key string, start, stop int, datadogAdditionalInfo map[string]string) (result map[string]float64, err error) {
+	return f.ZRevRangeWithscoresCtx(context.Background(), key, start, stop, datadogAdditionalInfo)
+}
+
+func (f *Fake) ZRevRangeWithscoresCtx(ctx context.Context, key string, start, stop int, datadogAdditionalInfo map[string]string) (result map[string]float64, err error) {
+	members, err := f.zrange(ctx, key, start, stop, true)
+	return memberScores(members), err
+}
+
+func (f *Fake) ZRange(key string, start, stop int, datadogAdditionalInfo map[string]string) (result []string, err error) {
+	return f.ZRangeCtx(context.Background(), key, start, stop, datadogAdditionalInfo)
+}
+
+func (f *Fake) ZRangeCtx(ctx context.Context, key string, start, stop int, datadogAdditionalInfo map[string]string) (result []string, err error) {
+	members, err := f.zrange(ctx, key, start, stop, false)
+	return memberNames(members), err
+}
+
+func (f *Fake) ZRangeWithscores(key string, start, stop int, datadogAdditionalInfo map[string]string) (result map[string]float64, err error) {
+	return f.ZRangeWithscoresCtx(context.Background(), key, start, stop, datadogAdditionalInfo)
+}
+
+func (f *Fake) ZRangeWithscoresCtx(ctx context.Context, key string, start, stop int, datadogAdditionalInfo map[string]string) (result map[string]float64, err error) {
+	members, err := f.zrange(ctx, key, start, stop, false)
+	return memberScores(members), err
+}
+
+func (f *Fake) ZRangeByScore(key, min, max string, datadogAdditionalInfo map[string]string) (result []string, err error) {
+	return f.ZRangeByScoreCtx(context.Background(), key, min, max, datadogAdditionalInfo)
+}
+
+func (f *Fake) ZRangeByScoreCtx(ctx context.Context, key, min, max string, datadogAdditionalInfo map[string]string) (result []string, err error) {
+	members, err := f.zrangeByScore(ctx, key, min, max)
+	return memberNames(members), err
+}
+
+func (f *Fake) ZRem(key string, members []string, datadogAdditionalInfo map[string]string) (err error) {
+	return f.ZRemCtx(context.Background(), key, members, datadogAdditionalInfo)
+}
+
+func (f *Fake) ZRemCtx(ctx context.Context, key string, members []string, datadogAdditionalInfo map[string]string) (err error) {
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	if len(members) <= 0 {
+		return errEmptyFields
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, err := f.get(key, kindZSet)
+	if err != nil || e == nil {
+		return
+	}
+	for _, m := range members {
+		delete(e.zset, m)
+	}
+	f.dropEmpty(key, e)
+	return
+}
+
+func (f *Fake) ZCount(key, min, max string, datadogAdditionalInfo map[string]string) (result int, err error) {
+	return f.ZCountCtx(context.Background(), key, min, max, datadogAdditionalInfo)
+}
+
+func (f *Fake) ZCountCtx(ctx context.Context, key, min, max string, datadogAdditionalInfo map[string]string) (result int, err error) {
+	members, err := f.zrangeByScore(ctx, key, min, max)
+	return len(members), err
+}
+
+// zmember is a sorted set member with its score
+type zmember struct {
+	member string
+	score  float64
+}
+
+// sortedMembers return members of e by score, then member, like redis
+func sortedMembers(e *entry) []zmember {
+	if e == nil {
+		return nil
+	}
+	members := make([]zmember, 0, len(e.zset))
+	for m, s := range e.zset {
+		members = append(members, zmember{member: m, score: s})
+	}
+	sort.Slice(members, func(a, b int) bool {
+		if members[a].score != members[b].score {
+			return members[a].score < members[b].score
+		}
+		return members[a].member < members[b].member
+	})
+	return members
+}
+
+func (f *Fake) zrange(ctx context.Context, key string, start, stop int, reverse bool) (members []zmember, err error) {
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, err := f.get(key, kindZSet)
+	if err != nil {
+		return
+	}
+	sorted := sortedMembers(e)
+	if reverse {
+		for a, b := 0, len(sorted)-1; a < b; a, b = a+1, b-1 {
+			sorted[a], sorted[b] = sorted[b], sorted[a]
+		}
+	}
+	from, to, ok := rangeIndexes(len(sorted), start, stop)
+	if !ok {
+		return []zmember{}, nil
+	}
+	return sorted[from : to+1], nil
+}
+
+func (f *Fake) zrangeByScore(ctx context.Context, key, min, max string) (members []zmember, err error) {
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	minScore, minExclusive, err := parseScore(min)
+	if err != nil {
+		return
+	}
+	maxScore, maxExclusive, err := parseScore(max)
+	if err != nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, err := f.get(key, kindZSet)
+	if err != nil {
+		return
+	}
+	members = []zmember{}
+	for _, m := range sortedMembers(e) {
+		if m.score < minScore || (minExclusive && m.score == minScore) {
+			continue
+		}
+		if m.score > maxScore || (maxExclusive && m.score == maxScore) {
+			continue
+		}
+		members = append(members, m)
+	}
+	return
+}
+
+// parseScore read a ZRANGEBYSCORE bound such as 1.5, (1.5, -inf or +inf
+func parseScore(bound string) (score float64, exclusive bool, err error) {
+	if strings.HasPrefix(bound, "(") {
+		exclusive = true
+		bound = bound[1:]
+	}
+	switch strings.ToLower(bound) {
+	case "-inf":
+		return math.Inf(-1), exclusive, nil
+	case "+inf", "inf":
+		return math.Inf(1), exclusive, nil
+	}
+	score, errParse := strconv.ParseFloat(bound, 64)
+	if errParse != nil {
+		return 0, false, errNotFloat
+	}
+	return score, exclusive, nil
+}
+
+func memberNames(members []zmember) []string {
+	if members == nil {
+		return nil
+	}
+	names := make([]string, 0, len(members))
+	for _, m := range members {
+		names = append(names, m.member)
+	}
+	return names
+}
+
+func memberScores(members []zmember) map[string]float64 {
+	scores := make(map[string]float64)
+	for _, m := range members {
+		scores[m.member] = m.score
+	}
+	return scores
+}
+
+// rangeIndexes turn redis start and stop, which may be negative, into inclusive slice bounds
+func rangeIndexes(length, start, stop int) (from, to int, ok bool) {
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	if start > stop || start >= length {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
+
+/*S Command*/
+func (f *Fake) SAdd(key string, members []string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error) {
+	return f.SAddCtx(context.Background(), key, members, expireSeconds, datadogAdditionalInfo)
+}
+
+func (f *Fake) SAddCtx(ctx context.Context, key string, members []string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error) {
+	if len(members) <= 0 {
+		return
+	}
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, err := f.getOrCreate(key, kindSet)
+	if err != nil {
+		return
+	}
+	for _, m := range members {
+		e.set[m] = true
+	}
+	if expireSeconds > 0 {
+		f.expire(key, expireSeconds)
+	}
+	return
+}
+
+func (f *Fake) SMembers(key string, datadogAdditionalInfo map[string]string) ([]string, error) {
+	return f.SMembersCtx(context.Background(), key, datadogAdditionalInfo)
+}
+
+func (f *Fake) SMembersCtx(ctx context.Context, key string, datadogAdditionalInfo map[string]string) ([]string, error) {
+	if err := ctxErr(ctx); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, err := f.get(key, kindSet)
+	if err != nil {
+		return nil, err
+	}
+	members := []string{}
+	if e != nil {
+		for m := range e.set {
+			members = append(members, m)
+		}
+	}
+	return members, nil
+}
+
+/*L Command*/
+func (f *Fake) RPush(key string, members []string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error) {
+	return f.RPushCtx(context.Background(), key, members, expireSeconds, datadogAdditionalInfo)
+}
+
+func (f *Fake) RPushCtx(ctx context.Context, key string, members []string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error) {
+	return f.push(ctx, key, members, expireSeconds, false)
+}
+
+func (f *Fake) LPush(key string, members []string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error) {
+	return f.LPushCtx(context.Background(), key, members, expireSeconds, datadogAdditionalInfo)
+}
+
+func (f *Fake) LPushCtx(ctx context.Context, key string, members []string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error) {
+	return f.push(ctx, key, members, expireSeconds, true)
+}
+
+func (f *Fake) push(ctx context.Context, key string, members []string, expireSeconds int, head bool) (err error) {
+	if len(members) <= 0 {
+		return
+	}
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, err := f.getOrCreate(key, kindList)
+	if err != nil {
+		return
+	}
+	for _, m := range members {
+		if head {
+			// LPUSH insert each member at the head in turn, so they end up reversed
+			e.list = append([]string{m}, e.list...)
+		} else {
+			e.list = append(e.list, m)
+		}
+	}
+	if expireSeconds > 0 {
+		f.expire(key, expireSeconds)
+	}
+	return
+}
+
+func (f *Fake) LRem(key string, count int, value string, datadogAdditionalInfo map[string]string) (err error) {
+	return f.LRemCtx(context.Background(), key, count, value, datadogAdditionalInfo)
+}
+
+func (f *Fake) LRemCtx(ctx context.Context, key string, count int, value string, datadogAdditionalInfo map[string]string) (err error) {
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, err := f.get(key, kindList)
+	if err != nil || e == nil {
+		return
+	}
+
+	// count > 0 remove from head, count < 0 from tail, 0 remove every occurrence
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	removed := 0
+	keep := make([]bool, len(e.list))
+	for n := range e.list {
+		idx := n
+		if count < 0 {
+			idx = len(e.list) - 1 - n
+		}
+		if e.list[idx] == value && (limit == 0 || removed < limit) {
+			removed++
+			continue
+		}
+		keep[idx] = true
+	}
+	list := make([]string, 0, len(e.list)-removed)
+	for idx, v := range e.list {
+		if keep[idx] {
+			list = append(list, v)
+		}
+	}
+	e.list = list
+	f.dropEmpty(key, e)
+	return
+}
+
+func (f *Fake) LTrim(key string, start, stop int, datadogAdditionalInfo map[string]string) (err error) {
+	return f.LTrimCtx(context.Background(), key, start, stop, datadogAdditionalInfo)
+}
+
+func (f *Fake) LTrimCtx(ctx context.Context, key string, start, stop int, datadogAdditionalInfo map[string]string) (err error) {
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, err := f.get(key, kindList)
+	if err != nil || e == nil {
+		return
+	}
+	from, to, ok := rangeIndexes(len(e.list), start, stop)
+	if !ok {
+		e.list = nil
+	} else {
+		e.list = append([]string{}, e.list[from:to+1]...)
+	}
+	f.dropEmpty(key, e)
+	return
+}
+
+func (f *Fake) LRange(key string, startIndex int, endIndex int, datadogAdditionalInfo map[string]string) ([]string, error) {
+	return f.LRangeCtx(context.Background(), key, startIndex, endIndex, datadogAdditionalInfo)
+}
+
+func (f *Fake) LRangeCtx(ctx context.Context, key string, startIndex int, endIndex int, datadogAdditionalInfo map[string]string) ([]string, error) {
+	if err := ctxErr(ctx); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, err := f.get(key, kindList)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return []string{}, nil
+	}
+	from, to, ok := rangeIndexes(len(e.list), startIndex, endIndex)
+	if !ok {
+		return []string{}, nil
+	}
+	return append([]string{}, e.list[from:to+1]...), nil
+}
+
+/*Key Command*/
+func (f *Fake) IsExist(key string, datadogAdditionalInfo map[string]string) (bool, error) {
+	return f.IsExistCtx(context.Background(), key, datadogAdditionalInfo)
+}
+
+func (f *Fake) IsExistCtx(ctx context.Context, key string, datadogAdditionalInfo map[string]string) (bool, error) {
+	if err := ctxErr(ctx); err != nil {
+		return false, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lookup(key) != nil, nil
+}
+
+func (f *Fake) Expire(key string, seconds int, datadogAdditionalInfo map[string]string) (result int, err error) {
+	return f.ExpireCtx(context.Background(), key, seconds, datadogAdditionalInfo)
+}
+
+func (f *Fake) ExpireCtx(ctx context.Context, key string, seconds int, datadogAdditionalInfo map[string]string) (result int, err error) {
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.expire(key, seconds), nil
+}
+
+func (f *Fake) Delete(key string, datadogAdditionalInfo map[string]string) (err error) {
+	return f.DeleteCtx(context.Background(), key, datadogAdditionalInfo)
+}
+
+func (f *Fake) DeleteCtx(ctx context.Context, key string, datadogAdditionalInfo map[string]string) (err error) {
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	f.mu.Lock()
+	delete(f.keys, key)
+	f.mu.Unlock()
+	return
+}
+
+func (f *Fake) Set(key string, value string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error) {
+	return f.SetCtx(context.Background(), key, value, expireSeconds, datadogAdditionalInfo)
+}
+
+func (f *Fake) SetCtx(ctx context.Context, key string, value string, expireSeconds int, datadogAdditionalInfo map[string]string) (err error) {
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := &entry{kind: kindString, str: value}
+	if expireSeconds > 0 {
+		e.expires = f.now.Add(time.Duration(expireSeconds) * time.Second)
+	}
+	f.keys[key] = e
+	return
+}
+
+func (f *Fake) Get(key string, datadogAdditionalInfo map[string]string) (level string, err error) {
+	return f.GetCtx(context.Background(), key, datadogAdditionalInfo)
+}
+
+func (f *Fake) GetCtx(ctx context.Context, key string, datadogAdditionalInfo map[string]string) (level string, err error) {
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, err := f.get(key, kindString)
+	if err != nil || e == nil {
+		return
+	}
+	return e.str, nil
+}
+
+func (f *Fake) GetBytes(key string, datadogAdditionalInfo map[string]string) (value []byte, found bool, err error) {
+	return f.GetBytesCtx(context.Background(), key, datadogAdditionalInfo)
+}
+
+func (f *Fake) GetBytesCtx(ctx context.Context, key string, datadogAdditionalInfo map[string]string) (value []byte, found bool, err error) {
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, err := f.get(key, kindString)
+	if err != nil || e == nil {
+		return
+	}
+	return []byte(e.str), true, nil
+}
+
+func (f *Fake) Rename(key string, newkey string) (err error) {
+	return f.RenameCtx(context.Background(), key, newkey)
+}
+
+func (f *Fake) RenameCtx(ctx context.Context, key string, newkey string) (err error) {
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := f.lookup(key)
+	if e == nil {
+		return errNoSuchKey
+	}
+	delete(f.keys, key)
+	f.keys[newkey] = e
+	return
+}
+
+/*Other Command*/
+func (f *Fake) Publish(channel string, message string, datadogAdditionalInfo map[string]string) (receivers int, err error) {
+	return f.PublishCtx(context.Background(), channel, message, datadogAdditionalInfo)
+}
+
+// PublishCtx record message, see Published. Nobody is subscribed to the fake so receivers is always 0
+func (f *Fake) PublishCtx(ctx context.Context, channel string, message string, datadogAdditionalInfo map[string]string) (receivers int, err error) {
+	if err = ctxErr(ctx); err != nil {
+		return
+	}
+	f.mu.Lock()
+	f.published = append(f.published, Message{Channel: channel, Message: message})
+	f.mu.Unlock()
+	return
+}
+
+func (f *Fake) Ping(ctx context.Context) (err error) {
+	return ctxErr(ctx)
+}
+
+func (f *Fake) Close() error {
+	return nil
+}
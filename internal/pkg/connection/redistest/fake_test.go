@@ -0,0 +1,15 @@
+package redistest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/loui58/odin/internal/pkg/connection"
+)
+
+func TestFakeConformance(t *testing.T) {
+	Conformance(t, func(t *testing.T) (connection.RedisClient, func(time.Duration)) {
+		f := NewFake()
+		return f, f.Advance
+	})
+}
@@ -0,0 +1,34 @@
+package redistest
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// Fake is an in-memory connection.RedisClient. Keys expire against its own clock, moved with Advance, so
+	// TTL behaviour is tested without sleeping. It is safe for concurrent use
+	Fake struct {
+		mu        sync.Mutex
+		now       time.Time
+		keys      map[string]*entry
+		published []Message
+	}
+
+	// Message is one Publish call seen by the fake
+	Message struct {
+		Channel string
+		Message string
+	}
+
+	// entry is one key, only the field matching kind is set
+	entry struct {
+		kind    string
+		str     string
+		hash    map[string]string
+		set     map[string]bool
+		list    []string
+		zset    map[string]float64
+		expires time.Time
+	}
+)
@@ -0,0 +1,192 @@
+package connection
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/loui58/odin/internal/pkg/connection"
+
+var (
+	// cqlLiteral match string, blob, uuid and number literals of a CQL statement
+	cqlLiteral = regexp.MustCompile(`'(?:[^']|'')*'|\b0x[0-9a-fA-F]+\b|\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b|-?\b\d+(?:\.\d+)?\b`)
+)
+
+// redisSpanKey hold the span started by the tracing hook, so After never end a span it did not start
+type redisSpanKey struct{}
+
+// tracer return tracer of the global provider, so a provider installed after NewRedis is still used
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// peerAttributes return server.address and server.port of a host:port address
+func peerAttributes(addr string) []attribute.KeyValue {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		if addr == "" {
+			return nil
+		}
+		return []attribute.KeyValue{semconv.ServerAddress(addr)}
+	}
+	attrs := []attribute.KeyValue{semconv.ServerAddress(host)}
+	if p, errPort := strconv.Atoi(port); errPort == nil {
+		attrs = append(attrs, semconv.ServerPort(p))
+	}
+	return attrs
+}
+
+// redisStatement return command with its keys, every other argument is replaced by ? so values never
+// reach the tracing backend
+func redisStatement(name string, args []interface{}) string {
+	keys := make(map[string]bool)
+	for _, k := range commandKeys(name, args) {
+		keys[k] = true
+	}
+
+	statement := []string{strings.ToUpper(name)}
+	for _, a := range args {
+		if s := argString(a); keys[s] {
+			statement = append(statement, s)
+			continue
+		}
+		statement = append(statement, "?")
+	}
+	return strings.Join(statement, " ")
+}
+
+// sanitizeCQL replace literals of a CQL statement by ?, bound values are never part of the statement
+func sanitizeCQL(stmt string) string {
+	return cqlLiteral.ReplaceAllString(stmt, "?")
+}
+
+// redisPeer return address of the node serving cmd
+func (i *RedisInstance) redisPeer(cmd *RedisCmd) string {
+	if i.cluster == nil {
+		return i.Config.Connection
+	}
+	name, args := cmd.Name, cmd.Args
+	if len(cmd.Cmds) > 0 {
+		name, args = cmd.Cmds[0].Name, cmd.Cmds[0].Args
+	}
+	slot, err := commandSlot(name, args)
+	if err != nil || slot < 0 {
+		return ""
+	}
+	return i.cluster.nodeForSlot(slot)
+}
+
+// tracingHook start one client span per command, pipeline or transaction, child of the span in the caller ctx
+func (i *RedisInstance) tracingHook() RedisHook {
+	before := func(ctx context.Context, cmd *RedisCmd) (context.Context, error) {
+		operation := strings.ToUpper(cmd.Name)
+		if cmd.pipeline {
+			operation = strings.ToUpper(cmd.Type)
+		}
+		attrs := append([]attribute.KeyValue{
+			semconv.DBSystemRedis,
+			semconv.DBOperation(operation),
+		}, peerAttributes(i.redisPeer(cmd))...)
+		if !cmd.pipeline {
+			attrs = append(attrs, semconv.DBStatement(redisStatement(cmd.Name, cmd.Args)))
+		}
+
+		ctx, span := tracer().Start(ctx, operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attrs...),
+		)
+		return context.WithValue(ctx, redisSpanKey{}, span), nil
+	}
+	after := func(ctx context.Context, cmd *RedisCmd) {
+		span, ok := ctx.Value(redisSpanKey{}).(trace.Span)
+		if !ok {
+			return
+		}
+		if cmd.pipeline {
+			// commands of a transaction are only known once it ran
+			var statements []string
+			for _, c := range cmd.Cmds {
+				statements = append(statements, redisStatement(c.Name, c.Args))
+			}
+			span.SetAttributes(semconv.DBStatement(strings.Join(statements, "\n")))
+		}
+		if cmd.Err != nil {
+			span.RecordError(cmd.Err)
+			span.SetStatus(codes.Error, cmd.Err.Error())
+		}
+		span.End()
+	}
+	return RedisHook{
+		BeforeCommand:  before,
+		AfterCommand:   after,
+		BeforePipeline: before,
+		AfterPipeline:  after,
+	}
+}
+
+// traceQuery record a finished query as a span, gocql observers are only called once the query is done
+func (o cassandraObserver) traceQuery(ctx context.Context, keyspace, operation, statement string, host *gocql.HostInfo, start, end time.Time, err error) {
+	attrs := []attribute.KeyValue{
+		semconv.DBSystemCassandra,
+		semconv.DBName(keyspace),
+		semconv.DBOperation(operation),
+		semconv.DBStatement(statement),
+	}
+	if host != nil {
+		attrs = append(attrs, peerAttributes(net.JoinHostPort(host.ConnectAddress().String(), strconv.Itoa(host.Port())))...)
+	}
+
+	_, span := o.tracer.Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(start),
+		trace.WithAttributes(attrs...),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End(trace.WithTimestamp(end))
+}
+
+// startSpan start span of an elastic request and attach it to the request context. Request body is never
+// recorded, db.statement is the method and path
+func (t elasticTransport) startSpan(r *http.Request) (*http.Request, trace.Span) {
+	operation := elasticRequestType(r)
+	attrs := append([]attribute.KeyValue{
+		semconv.DBSystemElasticsearch,
+		semconv.DBOperation(operation),
+		semconv.DBStatement(r.Method + " " + r.URL.Path),
+	}, peerAttributes(r.URL.Host)...)
+
+	ctx, span := t.tracer.Start(r.Context(), operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+	return r.WithContext(ctx), span
+}
+
+func endElasticSpan(span trace.Span, resp *http.Response, err error) {
+	switch {
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	case resp.StatusCode >= 400:
+		span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+		span.SetStatus(codes.Error, resp.Status)
+	default:
+		span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	}
+	span.End()
+}
@@ -1,16 +1,155 @@
 package connection
 
 import (
+	"io"
+	"time"
+
 	"github.com/garyburd/redigo/redis"
-	"github.com/tokopedia/r3/srcClean/datadog"
 )
 
 type (
 	RedisConfig struct {
 		Connection  string
 		IdleTimeout int
-		MaxActive   int
-		MaxIdle     int
+		// MaxActive is the pool size, default 600
+		MaxActive int
+		MaxIdle   int
+
+		// DialTimeout, ReadTimeout and WriteTimeout bound every connect, reply read and command write,
+		// default 5, 3 and 3 second. Commands sent with a ctx deadline wait for the reply until that deadline
+		// instead of ReadTimeout. Negative value disable the timeout
+		DialTimeout  time.Duration
+		ReadTimeout  time.Duration
+		WriteTimeout time.Duration
+		// PoolWaitTimeout is how long a command wait for a free connection once MaxActive are in use before
+		// failing with ErrRedisPoolExhausted, default ReadTimeout plus 1 second. Negative wait forever
+		PoolWaitTimeout time.Duration
+		// MaxConnLifetime close pooled connections older than it, so load spread again over new nodes, default
+		// 30 minute. Negative keep connections forever
+		MaxConnLifetime time.Duration
+		// HealthCheckInterval PING pooled connections idle longer than it before using them, default 1 minute.
+		// Negative disable the check
+		HealthCheckInterval time.Duration
+		// StatsInterval is how often pool statistics are pushed as gauges to the metrics recorder, default 10
+		// second. Negative disable the push, Stats still work
+		StatsInterval time.Duration
+		// TxMaxRetries is how many times Watch rerun the transaction when a watched key changed, 3 when unset.
+		// Negative disable the rerun
+		TxMaxRetries int
+
+		// Username and Password AUTH every connection, Username need redis 6 ACL. CredentialsFile is read on
+		// every dial instead, so rotated secrets are picked up, it hold the password alone or the username
+		// and the password on two lines
+		Username        string
+		Password        string
+		CredentialsFile string
+		// DB is the database SELECTed by every connection, ignored in cluster mode
+		DB int
+		// ClientName is set with CLIENT SETNAME, it is shown by CLIENT LIST
+		ClientName string
+		// TLS dial with TLS. TLSCAFile verify the server with this CA instead of the system pool, TLSCertFile and
+		// TLSKeyFile are the client certificate, TLSServerName override the host name checked in the server
+		// certificate
+		TLS           bool
+		TLSCAFile     string
+		TLSCertFile   string
+		TLSKeyFile    string
+		TLSServerName string
+		TLSSkipVerify bool
+
+		// ClusterNodes enable cluster mode when not empty. It is the seed host:port list used to
+		// discover the slot map, Connection is ignored in cluster mode
+		ClusterNodes []string
+		// ClusterMaxRedirects is how many MOVED/ASK redirections a command follows, default 5
+		ClusterMaxRedirects int
+
+		// SentinelMasterName enable sentinel mode when not empty, master address is asked to
+		// SentinelAddrs instead of dialing Connection. SentinelUsername and SentinelPassword AUTH sentinel
+		// connections, they are dialed with TLS when TLS is set. On failover idle connections to the old
+		// master are closed, connections in use are closed when returned to the pool
+		SentinelMasterName string
+		SentinelAddrs      []string
+		SentinelUsername   string
+		SentinelPassword   string
+
+		// ReplicaAddrs are host:port of read replicas, each with its own pool. Read-only commands are
+		// sent to a replica chosen by ReplicaSelection, writes always go to Connection. Ignored in cluster
+		// and sentinel mode
+		ReplicaAddrs []string
+		// ReplicaSelection is ReplicaRoundRobin, the default, or ReplicaLowestLatency
+		ReplicaSelection string
+
+		// Tracing create an OpenTelemetry span per command with the global tracer provider
+		Tracing bool
+
+		// Namespace is prepended to every key sent by the instance, such as "checkout:". SCAN results are
+		// returned without it. NearCache prefixes are compared to the full key
+		Namespace string
+
+		// Breaker fail commands fast while the instance is unhealthy, see BreakerConfig
+		Breaker BreakerConfig
+
+		// Retry resend commands failing with a transient error, see RetryConfig
+		Retry RetryConfig
+
+		// NearCache keep replies of hot reads in process memory, see NearCacheConfig
+		NearCache NearCacheConfig
+	}
+
+	// NearCacheConfig configure the in-process LRU in front of read commands, it is enabled when Prefixes is
+	// not empty. Entries are dropped as soon as redis report a change of their key, through CLIENT TRACKING on
+	// redis 6 or keyspace notifications before. Keyspace notifications must be enabled on the server
+	// (notify-keyspace-events with K and the event classes of cached keys). While the invalidation connection
+	// is down the near cache is emptied and bypassed. Ignored in cluster mode
+	NearCacheConfig struct {
+		// Prefixes opt keys in, only reads of a single key starting with one of them are cached
+		Prefixes []string
+		// MaxBytes cap the estimated size of cached keys and replies, default 64 MB
+		MaxBytes int64
+		// Entries live a random duration between MinTTL and MaxTTL even without invalidation, default 30
+		// second and 1 minute
+		MinTTL time.Duration
+		MaxTTL time.Duration
+		// Invalidation is NearCacheTracking, NearCacheKeyspace, or empty to use tracking when the server
+		// support it
+		Invalidation string
+	}
+
+	// RetryConfig configure retry of commands failing with a transient error such as connection reset,
+	// LOADING, TRYAGAIN or READONLY after a failover. It is enabled when MaxAttempts is above 1. Commands
+	// which may apply twice, such as ZINCRBY or RPUSH, are not retried unless RetryNonIdempotent is set.
+	// Transactions run by Watch only follow TxMaxRetries
+	RetryConfig struct {
+		// MaxAttempts is the total number of attempts, the first one included
+		MaxAttempts int
+		// MinBackoff is the wait before the first retry, doubled on every retry up to MaxBackoff.
+		// Default 8 millisecond and 512 millisecond, half of each wait is random
+		MinBackoff time.Duration
+		MaxBackoff time.Duration
+		// Retryable tell whether err is transient, default RetryableRedisError
+		Retryable func(err error) bool
+		// RetryNonIdempotent retry every command, including the ones which may apply twice
+		RetryNonIdempotent bool
+	}
+
+	// BreakerConfig configure the circuit breaker of a RedisInstance, it is enabled when ErrorRate or
+	// SlowCall is set. Failed and slow calls are counted over Window, the circuit opens when their ratio
+	// reach ErrorRate, stays open OpenTimeout, then let HalfOpenRequests probe calls through. The circuit
+	// closes again when every probe succeed
+	BreakerConfig struct {
+		// ErrorRate is the failure ratio, from 0 to 1, which open the circuit. Default 0.5 when only SlowCall is set
+		ErrorRate float64
+		// SlowCall count call slower than it as failure. Blocking commands such as BLPOP or XREADGROUP BLOCK
+		// are never slow
+		SlowCall time.Duration
+		// MinRequests is the number of calls in Window before the ratio is evaluated, default 20
+		MinRequests int
+		// Window is the period after which counters are reset while closed, default 10 second
+		Window time.Duration
+		// OpenTimeout is how long the circuit stay open, default 5 second
+		OpenTimeout time.Duration
+		// HalfOpenRequests is how many probe calls are let through while half-open, default 1
+		HalfOpenRequests int
 	}
 
 	CassandraConfig struct {
@@ -18,20 +157,62 @@ type (
 		Keyspace    string
 		Environment string
 		Port        int
+		// Tracing create an OpenTelemetry span per query and batch with the global tracer provider
+		Tracing bool
 	}
 
 	ElasticConfig struct {
 		DSN            string
 		SetSniff       bool
 		SetHealthcheck bool
+		// Tracing create an OpenTelemetry span per request with the global tracer provider
+		Tracing bool
 	}
 )
 
 type RedisOptionFunc func(*RedisInstance) error
+
+// MetricsRecorder receive latency of every redis, cassandra and elastic call. backend is "redis", "cassandra" or
+// "elastic", command is the call type (hgetall, select, _search, ...) and tags are extra "key:value" pairs
+type MetricsRecorder interface {
+	ObserveLatency(backend, command string, elapsed time.Duration, tags []string)
+	// SetGauge record current value of name, such as circuit breaker state
+	SetGauge(backend, name string, value float64, tags []string)
+	// AddCounter add delta to counter name, such as near cache hits
+	AddCounter(backend, name string, delta float64, tags []string)
+}
+
+// Codec turn a Go value into bytes stored in redis and back, see JSONCodec, MsgpackCodec and ProtobufCodec
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
 type (
 	RedisInstance struct {
+		// RedisPool is nil in cluster mode, every node has its own pool
 		RedisPool *redis.Pool
 		Config    RedisConfig
-		datadog   *datadog.DatadogInstance
+		metrics   MetricsRecorder
+		hooks     []RedisHook
+		breaker   *redisBreaker
+		replicas  *redisReplicas
+		near      *nearCache
+		cluster   *redisCluster
+		sentinel  *redisSentinel
+		// codec encode values of GetInto, SetFrom, HGetInto and HMSetStruct, JSONCodec when nil
+		codec Codec
+
+		scripts *redisScripts
+		waits   *poolWaits
+		// stop end the stats reporter on Close
+		stop chan struct{}
+
+		// shared is set on instances made by WithPrefix, they do not own the pools
+		shared bool
+		// ownMetrics is the recorder made by NewRedis or SetDatadog, closed with the instance
+		ownMetrics io.Closer
+		// builtinHooks is the count of leading hooks bound to the instance, breaker, metrics and tracing
+		builtinHooks int
 	}
 )
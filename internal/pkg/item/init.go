@@ -1,6 +1,13 @@
 package product
 
-import "github.com/gocql/gocql"
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/gocql/gocql"
+	"github.com/loui58/odin/internal/pkg/cache"
+)
 
 // Initialization
 func New(options ...ProductFunc) (instance *ProductInstance, err error) {
@@ -19,6 +26,61 @@ func New(options ...ProductFunc) (instance *ProductInstance, err error) {
 	return
 }
 
+// WithSession set cassandra session products are read from
+func WithSession(sess *gocql.Session) ProductFunc {
+	return func(i *ProductInstance) error {
+		i.cassandraSess = sess
+		return nil
+	}
+}
+
+// WithCache read products through c, cached under product:<id>
+func WithCache(c *cache.CacheInstance) ProductFunc {
+	return func(i *ProductInstance) error {
+		i.cache = c
+		return nil
+	}
+}
+
+// GetProduct return product of productID, through the cache when one is set. ErrProductNotFound is
+// returned when it does not exist
+func (i *ProductInstance) GetProduct(ctx context.Context, productID int) (product Product, err error) {
+	loader := func(ctx context.Context, key string) (interface{}, error) {
+		return i.loadProduct(ctx, productID)
+	}
+	if i.cache != nil {
+		err = i.cache.Get(ctx, "product:"+strconv.Itoa(productID), &product, loader)
+	} else {
+		var value interface{}
+		if value, err = loader(ctx, ""); err == nil {
+			product = value.(Product)
+		}
+	}
+	if err == cache.ErrNotFound {
+		err = ErrProductNotFound
+	}
+	return
+}
+
+// loadProduct read product from cassandra, it is the cache loader of GetProduct
+func (i *ProductInstance) loadProduct(ctx context.Context, productID int) (interface{}, error) {
+	if i.cassandraSess == nil {
+		return nil, ErrNoSession
+	}
+
+	var product Product
+	stmt := fmt.Sprintf("SELECT product_id, name, cat_id, description FROM %s.%s WHERE product_id = ?", i.keySpace, i.tableName)
+	err := i.cassandraSess.Query(stmt, productID).WithContext(ctx).
+		Scan(&product.ProductID, &product.Name, &product.CategoryID, &product.Description)
+	if err == gocql.ErrNotFound {
+		return nil, cache.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[error][product] Failed to read product %d %s", productID, err)
+	}
+	return product, nil
+}
+
 func (i *ProductInstance) GetKeyspace() (keyspace string) {
 	if i == nil {
 		return ""
@@ -1,6 +1,18 @@
 package product
 
-import "github.com/gocql/gocql"
+import (
+	"errors"
+
+	"github.com/gocql/gocql"
+	"github.com/loui58/odin/internal/pkg/cache"
+)
+
+var (
+	// ErrProductNotFound is returned by GetProduct when no row has the product id
+	ErrProductNotFound = errors.New("[error][product] product not found")
+	// ErrNoSession is returned by GetProduct when no cassandra session was set
+	ErrNoSession = errors.New("[error][product] cassandra session not set")
+)
 
 type ProductFunc func(*ProductInstance) error
 
@@ -8,6 +20,8 @@ type ProductInstance struct {
 	cassandraSess *gocql.Session
 	keySpace      string
 	tableName     string
+	// cache is optional, reads go straight to cassandra without it
+	cache *cache.CacheInstance
 }
 
 type Product struct {
@@ -0,0 +1,139 @@
+package datadog
+
+import (
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tokopedia/r3/srcClean/datadog"
+)
+
+// Recorder send latency to datadog with the tags RedisInstance always used: type:<command>, then
+// the given tags. Cassandra and elastic calls go to the same histogram tagged with backend:<backend>.
+// Gauges and counters are sent as DogStatsD metrics named <backend>.<name> to the agent, the DatadogInstance
+// only having a histogram
+type Recorder struct {
+	dd     *datadog.DatadogInstance
+	statsd net.Conn
+	// shared is set when statsd is the process wide agent socket of New
+	shared bool
+	once   sync.Once
+}
+
+// agent is the DogStatsD socket shared by every recorder made by New, closed once the last one is closed
+var agent struct {
+	mu   sync.Mutex
+	conn net.Conn
+	refs int
+}
+
+// New wrap dd, calls are dropped when dd is nil. Gauges and counters go to the agent at
+// DD_AGENT_HOST:DD_DOGSTATSD_PORT, localhost:8125 by default, over one socket shared by the process.
+// When the agent address can not be dialed the error is logged and gauges and counters are dropped
+func New(dd *datadog.DatadogInstance) *Recorder {
+	host, port := os.Getenv("DD_AGENT_HOST"), os.Getenv("DD_DOGSTATSD_PORT")
+	if host == "" {
+		host = "localhost"
+	}
+	if port == "" {
+		port = "8125"
+	}
+
+	r := &Recorder{dd: dd}
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+	if agent.conn == nil {
+		conn, err := net.Dial("udp", net.JoinHostPort(host, port))
+		if err != nil {
+			log.Println("[warning][datadog] gauges and counters are dropped, failed to dial agent:", err)
+			return r
+		}
+		agent.conn = conn
+	}
+	agent.refs++
+	r.statsd, r.shared = agent.conn, true
+	return r
+}
+
+// NewWithAgent wrap dd and send gauges and counters to the DogStatsD agent at addr over its own socket.
+// The recorder is usable even when err is not nil, gauges and counters are then dropped
+func NewWithAgent(dd *datadog.DatadogInstance, addr string) (*Recorder, error) {
+	r := &Recorder{dd: dd}
+	statsd, err := net.Dial("udp", addr)
+	if err != nil {
+		return r, err
+	}
+	r.statsd = statsd
+	return r, nil
+}
+
+// Close release the agent socket, the shared one of New is closed with its last recorder
+func (r *Recorder) Close() (err error) {
+	r.once.Do(func() {
+		if r.statsd == nil {
+			return
+		}
+		if !r.shared {
+			err = r.statsd.Close()
+			return
+		}
+		agent.mu.Lock()
+		defer agent.mu.Unlock()
+		agent.refs--
+		if agent.refs <= 0 && agent.conn != nil {
+			err = agent.conn.Close()
+			agent.conn, agent.refs = nil, 0
+		}
+	})
+	return
+}
+
+func (r *Recorder) ObserveLatency(backend, command string, elapsed time.Duration, tags []string) {
+	if r.dd == nil {
+		return
+	}
+	ddTags := append([]string{"type:" + command}, tags...)
+	if backend != "redis" {
+		ddTags = append(ddTags, "backend:"+backend)
+	}
+	r.dd.RedisHistogram(elapsed.Seconds()*1000, ddTags)
+}
+
+// SetGauge send <backend>.<name>:<value>|g with tags to the agent
+func (r *Recorder) SetGauge(backend, name string, value float64, tags []string) {
+	r.send(backend+"."+name, strconv.FormatFloat(value, 'f', -1, 64), "g", tags)
+}
+
+// AddCounter send <backend>.<name>:<delta>|c with tags to the agent
+func (r *Recorder) AddCounter(backend, name string, delta float64, tags []string) {
+	r.send(backend+"."+name, strconv.FormatFloat(delta, 'f', -1, 64), "c", tags)
+}
+
+// send write one DogStatsD datagram, errors are dropped as UDP delivery is best effort anyway
+func (r *Recorder) send(name, value, kind string, tags []string) {
+	if r.statsd == nil {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(statsdEscape.Replace(name))
+	b.WriteString(":")
+	b.WriteString(value)
+	b.WriteString("|")
+	b.WriteString(kind)
+	for idx, tag := range tags {
+		if idx == 0 {
+			b.WriteString("|#")
+		} else {
+			b.WriteString(",")
+		}
+		b.WriteString(statsdEscape.Replace(tag))
+	}
+	r.statsd.Write([]byte(b.String()))
+}
+
+// statsdEscape replace the DogStatsD separators which can not appear in names and tags
+var statsdEscape = strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", "_")
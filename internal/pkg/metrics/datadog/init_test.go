@@ -0,0 +1,72 @@
+package datadog
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSend(t *testing.T) {
+	agentConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agentConn.Close()
+
+	r, err := NewWithAgent(nil, agentConn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	tests := []struct {
+		name string
+		send func()
+		want string
+	}{
+		{name: "gauge", send: func() { r.SetGauge("redis", "breaker_state", 2, []string{"ipredis:a"}) },
+			want: "redis.breaker_state:2|g|#ipredis:a"},
+		{name: "counter without tag", send: func() { r.AddCounter("redis", "nearcache", 1.5, nil) },
+			want: "redis.nearcache:1.5|c"},
+		{name: "separators escaped", send: func() { r.AddCounter("redis", "a|b", 1, []string{"k:v,w", "x#y"}) },
+			want: "redis.a_b:1|c|#k:v_w,x_y"},
+	}
+	buf := make([]byte, 1024)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.send()
+			agentConn.SetReadDeadline(time.Now().Add(time.Second))
+			n, _, err := agentConn.ReadFrom(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(buf[:n]); got != tt.want {
+				t.Fatalf("datagram = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCloseShared(t *testing.T) {
+	t.Setenv("DD_AGENT_HOST", "127.0.0.1")
+	t.Setenv("DD_DOGSTATSD_PORT", "8125")
+
+	first, second := New(nil), New(nil)
+	if first.statsd == nil || first.statsd != second.statsd {
+		t.Fatal("recorders do not share the agent socket")
+	}
+	conn := first.statsd
+
+	first.Close()
+	first.Close()
+	if agent.conn != conn || agent.refs != 1 {
+		t.Fatalf("socket closed while still used, refs = %d", agent.refs)
+	}
+	second.Close()
+	if agent.conn != nil || agent.refs != 0 {
+		t.Fatalf("socket left open, refs = %d", agent.refs)
+	}
+	if _, err := conn.Write([]byte("x")); err == nil {
+		t.Fatal("write on closed socket succeeded")
+	}
+}
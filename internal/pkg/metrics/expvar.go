@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"expvar"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NewExpvar create recorder publishing under name, an existing map of the same name is reused
+func NewExpvar(name string) *ExpvarRecorder {
+	if vars, ok := expvar.Get(name).(*expvar.Map); ok {
+		return &ExpvarRecorder{vars: vars}
+	}
+	return &ExpvarRecorder{vars: expvar.NewMap(name)}
+}
+
+// ObserveLatency add one call to <backend>.<command>.count and its latency to <backend>.<command>.total_ms
+func (r *ExpvarRecorder) ObserveLatency(backend, command string, elapsed time.Duration, tags []string) {
+	key := backend + "." + command
+	r.vars.Add(key+".count", 1)
+	r.vars.AddFloat(key+".total_ms", elapsed.Seconds()*1000)
+}
+
+// SetGauge set <backend>.<name>{<tags>} to value
+func (r *ExpvarRecorder) SetGauge(backend, name string, value float64, tags []string) {
+	gauge := new(expvar.Float)
+	gauge.Set(value)
+	r.vars.Set(taggedKey(backend, name, tags), gauge)
+}
+
+// AddCounter add delta to <backend>.<name>{<tags>}
+func (r *ExpvarRecorder) AddCounter(backend, name string, delta float64, tags []string) {
+	r.vars.AddFloat(taggedKey(backend, name, tags), delta)
+}
+
+// taggedKey return <backend>.<name>{<tags>}, tags sorted so each tag set keep its own value
+func taggedKey(backend, name string, tags []string) string {
+	key := backend + "." + name
+	if len(tags) > 0 {
+		sorted := append([]string{}, tags...)
+		sort.Strings(sorted)
+		key += "{" + strings.Join(sorted, ",") + "}"
+	}
+	return key
+}
@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestTaggedKey(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+		want string
+	}{
+		{name: "no tag", want: "redis.nearcache"},
+		{name: "tags sorted", tags: []string{"result:hit", "ipredis:a"}, want: "redis.nearcache{ipredis:a,result:hit}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := taggedKey("redis", "nearcache", tt.tags); got != tt.want {
+				t.Fatalf("taggedKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpvarTagSets(t *testing.T) {
+	r := NewExpvar("metrics_test")
+	// the map is process wide, start empty when the test is run again
+	r.vars.Init()
+	r.AddCounter("redis", "nearcache", 1, []string{"result:hit"})
+	r.AddCounter("redis", "nearcache", 2, []string{"result:hit"})
+	r.AddCounter("redis", "nearcache", 1, []string{"result:miss"})
+	r.SetGauge("redis", "breaker_state", 2, []string{"ipredis:a"})
+	r.SetGauge("redis", "breaker_state", 0, []string{"ipredis:a"})
+
+	want := map[string]string{
+		"redis.nearcache{result:hit}":    "3",
+		"redis.nearcache{result:miss}":   "1",
+		"redis.breaker_state{ipredis:a}": "0",
+	}
+	for key, value := range want {
+		if got := r.vars.Get(key); got == nil || got.String() != value {
+			t.Fatalf("%s = %v, want %s", key, got, value)
+		}
+	}
+}
+
+func TestPrometheusLabelValues(t *testing.T) {
+	r, err := NewPrometheus(prometheus.NewRegistry(), "test", "source", "result")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		tags []string
+		want map[string]string
+	}{
+		{name: "no tag", want: map[string]string{}},
+		{name: "known and extra tags", tags: []string{"ipredis:10.0.0.1:6379", "source:checkout"},
+			want: map[string]string{"ipredis": "10.0.0.1:6379", "source": "checkout"}},
+		{name: "unknown and malformed tags dropped", tags: []string{"user:42", "nocolon"}, want: map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := r.labelValues("redis", "get", tt.tags)
+			if len(values) != 2+len(r.labels) || values[0] != "redis" || values[1] != "get" {
+				t.Fatalf("labelValues = %q", values)
+			}
+			got := map[string]string{}
+			for label, pos := range r.labels {
+				if values[2+pos] != "" {
+					got[label] = values[2+pos]
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("labels = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrometheusRegisteredTwice(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	first, err := NewPrometheus(reg, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewPrometheus(reg, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.AddCounter("redis", "nearcache", 1, []string{"result:hit"})
+	second.AddCounter("redis", "nearcache", 1, []string{"result:hit"})
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == "test_events_total" {
+			if got := family.GetMetric()[0].GetCounter().GetValue(); got != 2 {
+				t.Fatalf("events_total = %v, want 2", got)
+			}
+			return
+		}
+	}
+	t.Fatal("test_events_total not registered")
+}
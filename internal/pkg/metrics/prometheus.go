@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PrometheusTagLabels are the tag keys set by the connection, cache and ratelimit packages. Each one become a
+// label, empty when a call does not carry the tag
+var PrometheusTagLabels = []string{
+	"ipredis", "ipcassandra", "ipelastic", "keyspace", "namespace", "error",
+	"retry", "attempts", "commands", "script", "stream", "result",
+	"decision", "rule", "algorithm",
+}
+
+// NewPrometheus create recorder registering <namespace>_request_duration_seconds, <namespace>_state and
+// <namespace>_events_total on reg, prometheus.DefaultRegisterer when reg is nil. Tags are mapped to labels of the same key for
+// PrometheusTagLabels and extraLabels, such as keys of datadogAdditionalInfo
+func NewPrometheus(reg prometheus.Registerer, namespace string, extraLabels ...string) (*PrometheusRecorder, error) {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+
+	labels := make(map[string]int)
+	var labelNames []string
+	for _, l := range append(append([]string{}, PrometheusTagLabels...), extraLabels...) {
+		if _, ok := labels[l]; ok || l == "backend" || l == "command" || l == "name" {
+			continue
+		}
+		labels[l] = len(labelNames)
+		labelNames = append(labelNames, l)
+	}
+
+	latency := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_duration_seconds",
+		Help:      "Latency of redis, cassandra and elastic calls.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, append([]string{"backend", "command"}, labelNames...))
+	latencyCollector, err := register(reg, latency)
+	if err != nil {
+		return nil, err
+	}
+	state := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "state",
+		Help:      "Current value of connection gauges such as circuit breaker state.",
+	}, append([]string{"backend", "name"}, labelNames...))
+	stateCollector, err := register(reg, state)
+	if err != nil {
+		return nil, err
+	}
+
+	events := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_total",
+		Help:      "Count of connection events such as near cache hits and misses.",
+	}, append([]string{"backend", "name"}, labelNames...))
+	eventsCollector, err := register(reg, events)
+	if err != nil {
+		return nil, err
+	}
+
+	latency, okLatency := latencyCollector.(*prometheus.HistogramVec)
+	state, okState := stateCollector.(*prometheus.GaugeVec)
+	events, okEvents := eventsCollector.(*prometheus.CounterVec)
+	if !okLatency || !okState || !okEvents {
+		return nil, errors.New("[error][metrics] collector registered with another type")
+	}
+	return &PrometheusRecorder{latency: latency, state: state, events: events, labels: labels}, nil
+}
+
+// register add c to reg, returning the collector registered before under the same name if any
+func register(reg prometheus.Registerer, c prometheus.Collector) (prometheus.Collector, error) {
+	err := reg.Register(c)
+	if already, ok := err.(prometheus.AlreadyRegisteredError); ok {
+		return already.ExistingCollector, nil
+	}
+	return c, err
+}
+
+// labelValues return backend, command then the value of every label taken from "key:value" tags
+func (r *PrometheusRecorder) labelValues(backend, command string, tags []string) []string {
+	values := make([]string, 2+len(r.labels))
+	values[0], values[1] = backend, command
+	for _, tag := range tags {
+		idx := strings.Index(tag, ":")
+		if idx < 0 {
+			continue
+		}
+		if pos, ok := r.labels[tag[:idx]]; ok {
+			values[2+pos] = tag[idx+1:]
+		}
+	}
+	return values
+}
+
+func (r *PrometheusRecorder) ObserveLatency(backend, command string, elapsed time.Duration, tags []string) {
+	r.latency.WithLabelValues(r.labelValues(backend, command, tags)...).Observe(elapsed.Seconds())
+}
+
+func (r *PrometheusRecorder) SetGauge(backend, name string, value float64, tags []string) {
+	r.state.WithLabelValues(r.labelValues(backend, name, tags)...).Set(value)
+}
+
+func (r *PrometheusRecorder) AddCounter(backend, name string, delta float64, tags []string) {
+	r.events.WithLabelValues(r.labelValues(backend, name, tags)...).Add(delta)
+}
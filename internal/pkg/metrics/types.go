@@ -0,0 +1,25 @@
+package metrics
+
+import (
+	"expvar"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type (
+	// ExpvarRecorder publish call count and total latency per backend and command under one expvar map,
+	// readable at /debug/vars
+	ExpvarRecorder struct {
+		vars *expvar.Map
+	}
+
+	// PrometheusRecorder observe latency in a histogram labelled by backend, command and one label per known
+	// tag key. Tags whose key is not a label are dropped to keep label cardinality bounded
+	PrometheusRecorder struct {
+		latency *prometheus.HistogramVec
+		state   *prometheus.GaugeVec
+		events  *prometheus.CounterVec
+		// labels are the tag keys turned into labels, by position after backend and command or name
+		labels map[string]int
+	}
+)
@@ -0,0 +1,253 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loui58/odin/internal/pkg/connection"
+)
+
+const (
+	fixedWindowScript   = "ratelimit_fixed_window"
+	slidingWindowScript = "ratelimit_sliding_window"
+	tokenBucketScript   = "ratelimit_token_bucket"
+)
+
+// New create limiter on top of redis instance
+func New(rds *connection.RedisInstance, options ...LimiterFunc) (instance *LimiterInstance, err error) {
+	instance = &LimiterInstance{
+		redis:     rds,
+		keyPrefix: "ratelimit:",
+	}
+
+	for _, option := range options {
+		if err = option(instance); err != nil {
+			return nil, err
+		}
+	}
+
+	rds.RegisterScript(fixedWindowScript, `
+local n = redis.call("INCRBY", KEYS[1], ARGV[2])
+if n == tonumber(ARGV[2]) then redis.call("PEXPIRE", KEYS[1], ARGV[1]) end
+return {n, redis.call("PTTL", KEYS[1])}`)
+	rds.RegisterScript(slidingWindowScript, `
+local window = tonumber(ARGV[1])
+local now = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local n = #ARGV - 4
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", ARGV[4])
+local count = redis.call("ZCARD", KEYS[1])
+local allowed = 0
+if count + n <= limit then
+	for idx = 5, #ARGV do
+		redis.call("ZADD", KEYS[1], now, ARGV[idx])
+	end
+	count = count + n
+	allowed = 1
+end
+redis.call("PEXPIRE", KEYS[1], window)
+local reset = 0
+if count >= limit then
+	local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+	if oldest[2] then
+		reset = tonumber(oldest[2]) + window - now
+	end
+end
+return {allowed, count, reset}`)
+	rds.RegisterScript(tokenBucketScript, `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+local wait = 0
+if tokens >= cost then
+	tokens = tokens - cost
+	allowed = 1
+else
+	wait = math.ceil((cost - tokens) / rate)
+end
+redis.call("HMSET", KEYS[1], "tokens", tokens, "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst / rate))
+return {allowed, math.floor(tokens), wait}`)
+	return
+}
+
+// WithRule add a rule, a rule with the same prefix is replaced
+func WithRule(rule Rule) LimiterFunc {
+	return func(i *LimiterInstance) error {
+		if rule.Limit <= 0 || rule.Window < time.Millisecond {
+			return fmt.Errorf("[error][ratelimit] rule %q need positive Limit and Window of at least 1ms", rule.Prefix)
+		}
+		for idx, r := range i.rules {
+			if r.Prefix == rule.Prefix {
+				i.rules[idx] = rule
+				return nil
+			}
+		}
+		i.rules = append(i.rules, rule)
+		// longest prefix first so the most specific rule is found first
+		sort.SliceStable(i.rules, func(a, b int) bool {
+			return len(i.rules[a].Prefix) > len(i.rules[b].Prefix)
+		})
+		return nil
+	}
+}
+
+// WithMetrics report latency of every decision, tagged with decision, rule and algorithm
+func WithMetrics(metrics connection.MetricsRecorder) LimiterFunc {
+	return func(i *LimiterInstance) error {
+		i.metrics = metrics
+		return nil
+	}
+}
+
+// WithKeyPrefix set prefix of limiter keys in redis, default "ratelimit:"
+func WithKeyPrefix(prefix string) LimiterFunc {
+	return func(i *LimiterInstance) error {
+		i.keyPrefix = prefix
+		return nil
+	}
+}
+
+// Rule return the rule applied to key
+func (i *LimiterInstance) Rule(key string) (Rule, bool) {
+	for _, r := range i.rules {
+		if strings.HasPrefix(key, r.Prefix) {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Allow is AllowN for one request
+func (i *LimiterInstance) Allow(ctx context.Context, key string) (Result, error) {
+	return i.AllowN(ctx, key, 1)
+}
+
+// AllowN check and consume n requests of key with the rule matching its prefix, n must be at least one
+func (i *LimiterInstance) AllowN(ctx context.Context, key string, n int) (result Result, err error) {
+	loggingStartTime := time.Now()
+	if n < 1 {
+		return result, ErrInvalidN
+	}
+
+	rule, ok := i.Rule(key)
+	if !ok {
+		return result, ErrNoRule
+	}
+
+	redisKey := i.keyPrefix + key
+	switch rule.Algorithm {
+	case FixedWindow:
+		result, err = i.fixedWindow(ctx, redisKey, rule, n)
+	case SlidingWindowLog:
+		result, err = i.slidingWindowLog(ctx, redisKey, rule, n)
+	case TokenBucket:
+		result, err = i.tokenBucket(ctx, redisKey, rule, n)
+	default:
+		err = errors.New("[error][ratelimit] unknown algorithm")
+	}
+	if err != nil {
+		return
+	}
+
+	if i.metrics != nil {
+		decision := "allowed"
+		if !result.Allowed {
+			decision = "denied"
+		}
+		i.metrics.ObserveLatency("redis", "ratelimit", time.Since(loggingStartTime), []string{
+			"decision:" + decision,
+			"rule:" + rule.Prefix,
+			"algorithm:" + rule.Algorithm.String(),
+		})
+	}
+	return
+}
+
+func (i *LimiterInstance) fixedWindow(ctx context.Context, key string, rule Rule, n int) (result Result, err error) {
+	reply, err := i.redis.EvalScriptCtx(ctx, fixedWindowScript, []string{key}, []interface{}{int64(rule.Window / time.Millisecond), n}, nil).Int64s()
+	if err != nil {
+		return
+	}
+	if len(reply) < 2 {
+		return result, errors.New("[error][ratelimit] unexpected fixed window reply")
+	}
+
+	count, pttl := int(reply[0]), time.Duration(reply[1])*time.Millisecond
+	result.Allowed = count <= rule.Limit
+	result.Remaining = rule.Limit - count
+	if result.Remaining <= 0 {
+		result.Remaining = 0
+		result.ResetAfter = pttl
+	}
+	return
+}
+
+// slidingWindowLog trim, count and add in one script. Requests of a denied call are not logged
+func (i *LimiterInstance) slidingWindowLog(ctx context.Context, key string, rule Rule, n int) (result Result, err error) {
+	now := time.Now()
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+	windowMs := int64(rule.Window / time.Millisecond)
+
+	args := []interface{}{windowMs, nowMs, rule.Limit, "(" + strconv.FormatInt(nowMs-windowMs, 10)}
+	for c := 0; c < n; c++ {
+		args = append(args, strconv.FormatInt(now.UnixNano(), 10)+"-"+strconv.FormatInt(rand.Int63(), 36))
+	}
+
+	reply, err := i.redis.EvalScriptCtx(ctx, slidingWindowScript, []string{key}, args, nil).Int64s()
+	if err != nil {
+		return
+	}
+	if len(reply) < 3 {
+		return result, errors.New("[error][ratelimit] unexpected sliding window reply")
+	}
+
+	result.Allowed = reply[0] == 1
+	result.Remaining = rule.Limit - int(reply[1])
+	if result.Remaining <= 0 {
+		result.Remaining = 0
+		result.ResetAfter = time.Duration(reply[2]) * time.Millisecond
+	}
+	return
+}
+
+func (i *LimiterInstance) tokenBucket(ctx context.Context, key string, rule Rule, n int) (result Result, err error) {
+	nowMs := time.Now().UnixNano() / int64(time.Millisecond)
+	// refill rate in token per millisecond
+	rate := float64(rule.Limit) / float64(rule.Window/time.Millisecond)
+
+	reply, err := i.redis.EvalScriptCtx(ctx, tokenBucketScript, []string{key}, []interface{}{
+		strconv.FormatFloat(rate, 'f', -1, 64), rule.Limit, nowMs, n,
+	}, nil).Int64s()
+	if err != nil {
+		return
+	}
+	if len(reply) < 3 {
+		return result, errors.New("[error][ratelimit] unexpected token bucket reply")
+	}
+
+	result.Allowed = reply[0] == 1
+	result.Remaining = int(reply[1])
+	if result.Remaining <= 0 {
+		result.Remaining = 0
+		if result.Allowed {
+			result.ResetAfter = time.Duration(math.Ceil(1/rate)) * time.Millisecond
+		} else {
+			result.ResetAfter = time.Duration(reply[2]) * time.Millisecond
+		}
+	}
+	return
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/loui58/odin/internal/pkg/connection"
+)
+
+func TestAllowN(t *testing.T) {
+	// without REDIS_ADDR only the checks made before redis is called run
+	addr := os.Getenv("REDIS_ADDR")
+	rds, err := connection.NewRedisWithMetrics(connection.RedisConfig{Connection: addrOr(addr, "127.0.0.1:1")}, nil)
+	if err != nil {
+		t.Fatalf("redis: %s", err)
+	}
+	defer rds.Close()
+
+	var options []LimiterFunc
+	for _, a := range []Algorithm{FixedWindow, SlidingWindowLog, TokenBucket} {
+		options = append(options, WithRule(Rule{Prefix: a.String() + ":", Algorithm: a, Limit: 5, Window: time.Minute}))
+	}
+	options = append(options, WithKeyPrefix(fmt.Sprintf("ratelimittest:%d:", time.Now().UnixNano())))
+	limiter, err := New(rds, options...)
+	if err != nil {
+		t.Fatalf("new: %s", err)
+	}
+
+	// fixed window count denied requests too, the other algorithms only consume allowed ones
+	tests := []struct {
+		algorithm Algorithm
+		n         int
+		err       error
+		allowed   bool
+		remaining int
+	}{
+		{algorithm: FixedWindow, n: 0, err: ErrInvalidN},
+		{algorithm: FixedWindow, n: -1, err: ErrInvalidN},
+		{algorithm: FixedWindow, n: 2, allowed: true, remaining: 3},
+		{algorithm: FixedWindow, n: 4, allowed: false, remaining: 0},
+		{algorithm: SlidingWindowLog, n: 0, err: ErrInvalidN},
+		{algorithm: SlidingWindowLog, n: -1, err: ErrInvalidN},
+		{algorithm: SlidingWindowLog, n: 2, allowed: true, remaining: 3},
+		{algorithm: SlidingWindowLog, n: 4, allowed: false, remaining: 3},
+		{algorithm: SlidingWindowLog, n: 3, allowed: true, remaining: 0},
+		{algorithm: TokenBucket, n: 0, err: ErrInvalidN},
+		{algorithm: TokenBucket, n: -1, err: ErrInvalidN},
+		{algorithm: TokenBucket, n: 2, allowed: true, remaining: 3},
+		{algorithm: TokenBucket, n: 4, allowed: false, remaining: 3},
+		{algorithm: TokenBucket, n: 3, allowed: true, remaining: 0},
+	}
+	for _, tc := range tests {
+		if tc.err == nil && addr == "" {
+			continue
+		}
+		result, err := limiter.AllowN(context.Background(), tc.algorithm.String()+":key", tc.n)
+		if err != tc.err {
+			t.Fatalf("%s n=%d: err %v, want %v", tc.algorithm, tc.n, err, tc.err)
+		}
+		if err != nil {
+			continue
+		}
+		if result.Allowed != tc.allowed || result.Remaining != tc.remaining {
+			t.Errorf("%s n=%d: allowed %v remaining %d, want %v %d", tc.algorithm, tc.n, result.Allowed, result.Remaining, tc.allowed, tc.remaining)
+		}
+	}
+}
+
+func addrOr(addr, fallback string) string {
+	if addr == "" {
+		return fallback
+	}
+	return addr
+}
@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"errors"
+	"time"
+
+	"github.com/loui58/odin/internal/pkg/connection"
+)
+
+// Algorithm select how a Rule count requests
+type Algorithm int
+
+const (
+	// FixedWindow count requests in consecutive windows with INCR, cheapest but allow bursts at window edges
+	FixedWindow Algorithm = iota
+	// SlidingWindowLog keep one sorted set member per request inside the last window
+	SlidingWindowLog
+	// TokenBucket refill Limit tokens every Window, allowing bursts up to Limit
+	TokenBucket
+)
+
+// ErrNoRule is returned when no rule prefix match the key
+var ErrNoRule = errors.New("[error][ratelimit] no rule match key")
+
+// ErrInvalidN is returned by AllowN when n is less than one, a negative n would give quota back
+var ErrInvalidN = errors.New("[error][ratelimit] n must be at least one")
+
+type LimiterFunc func(*LimiterInstance) error
+
+type (
+	LimiterInstance struct {
+		redis     *connection.RedisInstance
+		metrics   connection.MetricsRecorder
+		keyPrefix string
+		rules     []Rule
+	}
+
+	// Rule apply to every key starting with Prefix, the longest matching prefix win
+	Rule struct {
+		Prefix    string
+		Algorithm Algorithm
+		// Limit is allowed requests per Window, or bucket capacity for TokenBucket
+		Limit  int
+		Window time.Duration
+	}
+
+	// Result is a limiter decision. ResetAfter is how long until another request can be allowed,
+	// zero while Remaining is positive
+	Result struct {
+		Allowed    bool
+		Remaining  int
+		ResetAfter time.Duration
+	}
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case FixedWindow:
+		return "fixed_window"
+	case SlidingWindowLog:
+		return "sliding_window_log"
+	case TokenBucket:
+		return "token_bucket"
+	}
+	return "unknown"
+}